@@ -0,0 +1,71 @@
+package forth
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Double-cell numbers are 128-bit integers which live on the stack as two cells, with the high cell on top.
+
+func negateDouble(lo, hi uint64) (uint64, uint64) {
+	lo, borrow := bits.Sub64(0, lo, 0)
+	hi, _ = bits.Sub64(0, hi, borrow)
+	return lo, hi
+}
+
+func multiplySigned(n1, n2 int64) (uint64, uint64) {
+	hi, lo := bits.Mul64(absolute(n1), absolute(n2))
+	if (n1 < 0) != (n2 < 0) {
+		return negateDouble(lo, hi)
+	}
+	return lo, hi
+}
+
+// Returns the magnitude of n. It has to be unsigned so that the magnitude of math.MinInt64 fits.
+func absolute(n int64) uint64 {
+	if n < 0 {
+		return uint64(-n)
+	}
+	return uint64(n)
+}
+
+// Divides a signed double-cell number by n, rounding the quotient towards zero. The remainder has the same sign as
+// the dividend. Reports false if the quotient doesn't fit in a single cell. Callers have to check for division by zero.
+func divideSymmetric(lo, hi uint64, n int64) (int64, int64, bool) {
+	negative := int64(hi) < 0
+	if negative {
+		lo, hi = negateDouble(lo, hi)
+	}
+	divisor := absolute(n)
+	if hi >= divisor {
+		return 0, 0, false
+	}
+
+	q, r := bits.Div64(hi, lo, divisor)
+	quotientNegative := negative != (n < 0)
+	if q > math.MaxInt64 && !(quotientNegative && q == 1<<63) {
+		return 0, 0, false
+	}
+
+	quotient, remainder := int64(q), int64(r)
+	if quotientNegative {
+		quotient = -quotient
+	}
+	if negative {
+		remainder = -remainder
+	}
+	return remainder, quotient, true
+}
+
+// Like divideSymmetric, but rounds the quotient towards negative infinity. The remainder has the same sign as n.
+func divideFloored(lo, hi uint64, n int64) (int64, int64, bool) {
+	remainder, quotient, ok := divideSymmetric(lo, hi, n)
+	if ok && remainder != 0 && (remainder < 0) != (n < 0) {
+		if quotient == math.MinInt64 {
+			return 0, 0, false
+		}
+		quotient--
+		remainder += n
+	}
+	return remainder, quotient, ok
+}
@@ -0,0 +1,732 @@
+package forth
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const builtinWords = `
+	: true -1 ;
+	: false 0 ;
+	: bl 32 ;
+	: decimal 10 base ! ;
+	: hex 16 base ! ;
+	: binary 2 base ! ;
+	: char parse-name drop c@ ;
+	: [char] char postpone literal ; immediate
+`
+
+// Words which compile straight to a single VM instruction instead of a call.
+var primitives = map[string]AbstractOp{
+	".":          {OP_PRINT, 0, VoidDatum{}, Position{}},
+	"+":          {OP_ADD, 0, VoidDatum{}, Position{}},
+	"mod":        {OP_MOD, 0, VoidDatum{}, Position{}},
+	"dup":        {OP_DUP, 0, VoidDatum{}, Position{}},
+	"over":       {OP_DUP, 1, VoidDatum{}, Position{}},
+	"drop":       {OP_DROP, 1, VoidDatum{}, Position{}},
+	"2drop":      {OP_DROP, 2, VoidDatum{}, Position{}},
+	"2dup":       {OP_TWO_DUP, 0, VoidDatum{}, Position{}},
+	"swap":       {OP_SWAP, 0, VoidDatum{}, Position{}},
+	"rot":        {OP_ROT, 0, VoidDatum{}, Position{}},
+	"-rot":       {OP_MINUS_ROT, 0, VoidDatum{}, Position{}},
+	"nip":        {OP_NIP, 0, VoidDatum{}, Position{}},
+	"tuck":       {OP_TUCK, 0, VoidDatum{}, Position{}},
+	"pick":       {OP_PICK, 0, VoidDatum{}, Position{}},
+	"roll":       {OP_ROLL, 0, VoidDatum{}, Position{}},
+	"?dup":       {OP_QDUP, 0, VoidDatum{}, Position{}},
+	"depth":      {OP_DEPTH, 0, VoidDatum{}, Position{}},
+	"2swap":      {OP_TWO_SWAP, 0, VoidDatum{}, Position{}},
+	"2over":      {OP_TWO_OVER, 0, VoidDatum{}, Position{}},
+	"2rot":       {OP_TWO_ROT, 0, VoidDatum{}, Position{}},
+	">r":         {OP_TO_R, 0, VoidDatum{}, Position{}},
+	"r>":         {OP_R_FROM, 0, VoidDatum{}, Position{}},
+	"r@":         {OP_R_FETCH, 0, VoidDatum{}, Position{}},
+	"2>r":        {OP_TWO_TO_R, 0, VoidDatum{}, Position{}},
+	"2r>":        {OP_TWO_R_FROM, 0, VoidDatum{}, Position{}},
+	"2r@":        {OP_TWO_R_FETCH, 0, VoidDatum{}, Position{}},
+	"-":          {OP_SUB, 0, VoidDatum{}, Position{}},
+	"*":          {OP_MUL, 0, VoidDatum{}, Position{}},
+	"/":          {OP_DIV, 0, VoidDatum{}, Position{}},
+	"/mod":       {OP_DIV_MOD, 0, VoidDatum{}, Position{}},
+	"*/":         {OP_STAR_SLASH, 0, VoidDatum{}, Position{}},
+	"*/mod":      {OP_STAR_SLASH_MOD, 0, VoidDatum{}, Position{}},
+	"negate":     {OP_NEGATE, 0, VoidDatum{}, Position{}},
+	"abs":        {OP_ABS, 0, VoidDatum{}, Position{}},
+	"min":        {OP_MIN, 0, VoidDatum{}, Position{}},
+	"max":        {OP_MAX, 0, VoidDatum{}, Position{}},
+	"and":        {OP_AND, 0, VoidDatum{}, Position{}},
+	"or":         {OP_OR, 0, VoidDatum{}, Position{}},
+	"xor":        {OP_XOR, 0, VoidDatum{}, Position{}},
+	"invert":     {OP_INVERT, 0, VoidDatum{}, Position{}},
+	"lshift":     {OP_LSHIFT, 0, VoidDatum{}, Position{}},
+	"rshift":     {OP_RSHIFT, 0, VoidDatum{}, Position{}},
+	"=":          {OP_EQUAL, 0, VoidDatum{}, Position{}},
+	"<>":         {OP_NOT_EQUAL, 0, VoidDatum{}, Position{}},
+	"<":          {OP_LESS, 0, VoidDatum{}, Position{}},
+	">":          {OP_GREATER, 0, VoidDatum{}, Position{}},
+	"u<":         {OP_U_LESS, 0, VoidDatum{}, Position{}},
+	"u>":         {OP_U_GREATER, 0, VoidDatum{}, Position{}},
+	"0=":         {OP_ZERO_EQUAL, 0, VoidDatum{}, Position{}},
+	"0<>":        {OP_ZERO_NOT_EQUAL, 0, VoidDatum{}, Position{}},
+	"0<":         {OP_ZERO_LESS, 0, VoidDatum{}, Position{}},
+	"0>":         {OP_ZERO_GREATER, 0, VoidDatum{}, Position{}},
+	"1+":         {OP_ONE_PLUS, 0, VoidDatum{}, Position{}},
+	"1-":         {OP_ONE_MINUS, 0, VoidDatum{}, Position{}},
+	"2*":         {OP_TWO_STAR, 0, VoidDatum{}, Position{}},
+	"2/":         {OP_TWO_SLASH, 0, VoidDatum{}, Position{}},
+	"within":     {OP_WITHIN, 0, VoidDatum{}, Position{}},
+	"s>d":        {OP_S_TO_D, 0, VoidDatum{}, Position{}},
+	"m*":         {OP_M_STAR, 0, VoidDatum{}, Position{}},
+	"um*":        {OP_UM_STAR, 0, VoidDatum{}, Position{}},
+	"um/mod":     {OP_UM_SLASH_MOD, 0, VoidDatum{}, Position{}},
+	"fm/mod":     {OP_FM_SLASH_MOD, 0, VoidDatum{}, Position{}},
+	"sm/rem":     {OP_SM_SLASH_REM, 0, VoidDatum{}, Position{}},
+	"here":       {OP_HERE, 0, VoidDatum{}, Position{}},
+	"allot":      {OP_ALLOT, 0, VoidDatum{}, Position{}},
+	",":          {OP_COMMA, 0, VoidDatum{}, Position{}},
+	"c,":         {OP_C_COMMA, 0, VoidDatum{}, Position{}},
+	"!":          {OP_STORE, 0, VoidDatum{}, Position{}},
+	"@":          {OP_FETCH, 0, VoidDatum{}, Position{}},
+	"c!":         {OP_C_STORE, 0, VoidDatum{}, Position{}},
+	"c@":         {OP_C_FETCH, 0, VoidDatum{}, Position{}},
+	"2!":         {OP_TWO_STORE, 0, VoidDatum{}, Position{}},
+	"2@":         {OP_TWO_FETCH, 0, VoidDatum{}, Position{}},
+	"+!":         {OP_PLUS_STORE, 0, VoidDatum{}, Position{}},
+	"cells":      {OP_CELLS, 0, VoidDatum{}, Position{}},
+	"cell+":      {OP_CELL_PLUS, 0, VoidDatum{}, Position{}},
+	"chars":      {OP_CHARS, 0, VoidDatum{}, Position{}},
+	"char+":      {OP_ONE_PLUS, 0, VoidDatum{}, Position{}},
+	"align":      {OP_ALIGN, 0, VoidDatum{}, Position{}},
+	"aligned":    {OP_ALIGNED, 0, VoidDatum{}, Position{}},
+	"fill":       {OP_FILL, 0, VoidDatum{}, Position{}},
+	"move":       {OP_MOVE, 0, VoidDatum{}, Position{}},
+	"erase":      {OP_ERASE, 0, VoidDatum{}, Position{}},
+	"state":      {OP_PUSH, 0, IntegerDatum{STATE_ADDRESS}, Position{}},
+	"base":       {OP_PUSH, 0, IntegerDatum{BASE_ADDRESS}, Position{}},
+	"u.":         {OP_U_PRINT, 0, VoidDatum{}, Position{}},
+	".r":         {OP_PRINT_R, 0, VoidDatum{}, Position{}},
+	"u.r":        {OP_U_PRINT_R, 0, VoidDatum{}, Position{}},
+	">number":    {OP_TO_NUMBER, 0, VoidDatum{}, Position{}},
+	"<#":         {OP_LESS_NUMBER_SIGN, 0, VoidDatum{}, Position{}},
+	"#":          {OP_NUMBER_SIGN, 0, VoidDatum{}, Position{}},
+	"#s":         {OP_NUMBER_SIGN_S, 0, VoidDatum{}, Position{}},
+	"hold":       {OP_HOLD, 0, VoidDatum{}, Position{}},
+	"holds":      {OP_HOLDS, 0, VoidDatum{}, Position{}},
+	"sign":       {OP_SIGN, 0, VoidDatum{}, Position{}},
+	"#>":         {OP_NUMBER_SIGN_GREATER, 0, VoidDatum{}, Position{}},
+	"type":       {OP_TYPE, 0, VoidDatum{}, Position{}},
+	"emit":       {OP_EMIT, 0, VoidDatum{}, Position{}},
+	"cr":         {OP_EMIT, '\n', VoidDatum{}, Position{}},
+	"space":      {OP_EMIT, ' ', VoidDatum{}, Position{}},
+	"spaces":     {OP_SPACES, 0, VoidDatum{}, Position{}},
+	"key":        {OP_KEY, 0, VoidDatum{}, Position{}},
+	"key?":       {OP_KEY_QUESTION, 0, VoidDatum{}, Position{}},
+	"accept":     {OP_ACCEPT, 0, VoidDatum{}, Position{}},
+	"count":      {OP_COUNT, 0, VoidDatum{}, Position{}},
+	"source":     {OP_SOURCE, 0, VoidDatum{}, Position{}},
+	">in":        {OP_PUSH, 0, IntegerDatum{TO_IN_ADDRESS}, Position{}},
+	"parse":      {OP_PARSE, 0, VoidDatum{}, Position{}},
+	"parse-name": {OP_PARSE_NAME, 0, VoidDatum{}, Position{}},
+	"word":       {OP_WORD, 0, VoidDatum{}, Position{}},
+	"bye":        {OP_BYE, 0, VoidDatum{}, Position{}},
+	"(bye)":      {OP_BYE, 1, VoidDatum{}, Position{}},
+	"execute":    {OP_EXECUTE, 0, VoidDatum{}, Position{}},
+	"catch":      {OP_CATCH, 0, VoidDatum{}, Position{}},
+	"throw":      {OP_THROW, 0, VoidDatum{}, Position{}},
+	"abort":      {OP_THROW, -THROW_ABORT, VoidDatum{}, Position{}},
+	">body":      {OP_TO_BODY, 0, VoidDatum{}, Position{}},
+	"exit":       {OP_RETURN, 0, VoidDatum{}, Position{}},
+	"i":          {OP_I, 0, VoidDatum{}, Position{}},
+	"j":          {OP_J, 0, VoidDatum{}, Position{}},
+	"unloop":     {OP_UNLOOP, 0, VoidDatum{}, Position{}},
+}
+
+// Words which move things on and off the return stack. They're compile-only, because code that's run straight away
+// keeps its return address on the return stack too, and they'd trip over it.
+var returnStackWords = map[string]bool{">r": true, "r>": true, "r@": true, "2>r": true, "2r>": true, "2r@": true}
+
+// Calls to undefined words get this address until the word is defined, so that they fail instead of jumping into
+// whatever happens to be at address 0.
+const UNDEFINED_ADDRESS = 0xFFFFFF
+
+type Compiler struct {
+	parser *Parser
+	vm *VirtualMachine
+	current *Word // The word being compiled, if any
+	anonymous bool // True if current is some top-level code that'll be run as soon as its control structures end
+	control []controlEntry // The control structures we're inside, innermost last
+	immediates map[uint32]bool // Words which run at compile time, keyed by code address
+	fixups []fixup // Calls to words which hadn't been defined yet when they were compiled
+	batch int // Counts calls to LoadCode, so that we know which fixups came from which one
+	definitions []definition // The words installed during this batch, in case it fails and we have to take them back
+	values map[uint32]int64 // The data space address of each word created by 'value', keyed by its code address
+	defers map[uint32]int64 // Likewise for 'defer', whose cells hold execution tokens
+	stubs map[string]uint32 // Words which give primitives and defining words an execution token
+	hostCalls map[string]uint32 // The VM host functions which compiled code uses to call back into the compiler
+	transientBuffer int // Which of the VM's transient buffers the next interpreted string goes in
+	lines int // How many lines LoadLine has read, so that errors in the REPL say which line they're on
+
+	// Calls at the end of a word normally become jumps, so that tail recursion doesn't fill up the return stack. Set
+	// this if you'd rather see every call on the return stack, or have words which fiddle with their return address.
+	NoTailCalls bool
+}
+
+// A call to a word which hasn't been defined yet. It gets patched when the word shows up.
+type fixup struct {
+	address uint32
+	op AbstractOp
+	batch int
+}
+
+// A word that was installed during the current batch, and what the dictionary said before it came along.
+type definition struct {
+	key string
+	start, end uint32
+	previous uint32
+	redefined bool
+	previousLatest uint32
+}
+
+func (w *Word) Finish(pos Position) {
+	w.Ops = append(w.Ops, AbstractOp{OP_RETURN, 0, VoidDatum{}, pos})
+}
+
+func NewCompiler(vm *VirtualMachine) *Compiler {
+	c := Compiler{
+		parser: newParser(vm),
+		vm: vm,
+		immediates: make(map[uint32]bool),
+		values: make(map[uint32]int64),
+		defers: make(map[uint32]int64),
+		stubs: make(map[string]uint32),
+		hostCalls: make(map[string]uint32),
+	}
+	return &c
+}
+
+// The first byte of the uint32 is the opcode; the remaining 3 bytes are some sort of argument to the instruction.
+func (c *Compiler) convertToPackedOp(start uint32, op AbstractOp, opIndex int) PackedOp {
+	switch op.Opcode {
+	case OP_CALL, OP_TAIL_CALL:
+		// A call with no name comes from 'recurse', and calls the word it's in. One with an address comes from
+		// 'postpone', and calls whichever word had the name when it was postponed.
+		if address, ok := op.Datum.(IntegerDatum); ok {
+			op.Arg = uint32(address.Int)
+			break
+		} else if _, ok := op.Datum.(StringDatum); !ok {
+			op.Arg = start
+			break
+		}
+		word_name := op.Datum.(StringDatum).Str
+		if address, ok := c.vm.Dict[word_name]; ok {
+			op.Arg = address
+		} else {
+			op.Arg = UNDEFINED_ADDRESS
+			c.fixups = append(c.fixups, fixup{start + uint32(opIndex), op, c.batch})
+		}
+
+	case OP_PUSH:
+		c.vm.Heap = append(c.vm.Heap, op.Datum)
+		op.Arg = uint32(len(c.vm.Heap)) - 1
+
+	case OP_JUMP, OP_JUMP_IF_NOT, OP_QDO, OP_LOOP, OP_PLUS_LOOP, OP_DOES:
+		op.Arg = start + uint32(opIndex) + uint32(op.Arg)
+	}
+	return PackedOp(uint32(op.Opcode) | (op.Arg << 8))
+}
+
+// Converts some ops to PackedOps and appends them to the VM's code. Returns the address of the first one.
+func (c *Compiler) pack(ops []AbstractOp) uint32 {
+	start := uint32(len(c.vm.Code))
+	for i, op := range ops {
+		c.vm.Code = append(c.vm.Code, c.convertToPackedOp(start, op, i))
+		c.vm.positions = append(c.vm.positions, op.Pos)
+	}
+	return start
+}
+
+// Packs a finished word into the VM and adds it to the dictionary.
+func (c *Compiler) install(word Word) uint32 {
+	key := c.vm.dictKey(word.Name)
+	previous, redefined := c.vm.Dict[key]
+	previousLatest := c.vm.latest
+
+	address := c.pack(word.Ops)
+	c.definitions = append(c.definitions, definition{key, address, uint32(len(c.vm.Code)), previous, redefined, previousLatest})
+	c.define(word.Name, address)
+	return address
+}
+
+// Takes the words from this batch which call something that never got defined back out of the dictionary, along
+// with any words which call them, so that they can't hang around and throw when someone uses them.
+func (c *Compiler) uninstallBroken() {
+	broken := map[uint32]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, d := range c.definitions {
+			if !broken[d.start] && c.callsBroken(d, broken) {
+				broken[d.start] = true
+				changed = true
+			}
+		}
+	}
+
+	for i := len(c.definitions) - 1; i >= 0; i-- {
+		d := c.definitions[i]
+		if !broken[d.start] {
+			continue
+		}
+		if d.redefined {
+			c.vm.Dict[d.key] = d.previous
+		} else {
+			delete(c.vm.Dict, d.key)
+		}
+		if c.vm.latest == d.start {
+			c.vm.latest = d.previousLatest
+		}
+	}
+
+	remaining := c.fixups[:0]
+	for _, f := range c.fixups {
+		if f.batch != c.batch {
+			remaining = append(remaining, f)
+		}
+	}
+	c.fixups = remaining
+}
+
+// Reports whether a word calls an undefined word, or one of the broken ones.
+func (c *Compiler) callsBroken(d definition, broken map[uint32]bool) bool {
+	for address := d.start; address < d.end; address++ {
+		opcode, arg := uint8(c.vm.Code[address] & 0xFF), uint32(c.vm.Code[address] >> 8)
+		if (opcode == OP_CALL || opcode == OP_TAIL_CALL) && (arg == UNDEFINED_ADDRESS || broken[arg]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds a word to the dictionary and patches any earlier calls to it which were waiting for it to be defined.
+func (c *Compiler) define(name string, address uint32) {
+	key := c.vm.dictKey(name)
+	c.vm.Dict[key] = address
+	c.vm.names[address] = name
+	c.vm.latest = address
+
+	remaining := c.fixups[:0]
+	for _, f := range c.fixups {
+		if f.op.Datum.(StringDatum).Str == key {
+			c.vm.Code[f.address] = PackedOp(uint32(f.op.Opcode) | (address << 8))
+		} else {
+			remaining = append(remaining, f)
+		}
+	}
+	c.fixups = remaining
+}
+
+// We don't want the builtins loaded during tests, so it's a separate method.
+func (c *Compiler) LoadBuiltins() error {
+	return c.LoadCode(strings.NewReader(builtinWords))
+}
+
+// Interprets the code: word definitions get compiled into the VM, and everything else gets executed right away.
+// FIXME: I don't like that Compiler reaches into VM like this.
+func (c *Compiler) LoadCode(code io.Reader) error {
+	defer c.reset()
+
+	if _, err := c.interpret(code, 0); err != nil {
+		return err
+	}
+	if err := c.checkFinished(); err != nil {
+		return err
+	}
+	return c.checkFixups()
+}
+
+// Like LoadCode, but a definition or control structure can carry on into the next call. That's what you want when
+// code comes in a line at a time. If anything goes wrong, the unfinished definition gets thrown away. Line numbers
+// carry on from the previous call, too.
+func (c *Compiler) LoadLine(code io.Reader) error {
+	lines, err := c.interpret(code, c.lines)
+	c.lines = lines
+	if err == nil {
+		err = c.checkFixups()
+	}
+	if err != nil {
+		c.reset()
+	}
+	return err
+}
+
+// Interprets code whose first line comes after the given line number. Returns the number of the last line it read.
+func (c *Compiler) interpret(code io.Reader, line int) (int, error) {
+	source := c.parser.pushReader(code, line)
+	defer c.parser.pop()
+	c.batch++
+	c.definitions = nil
+	err := c.interpretSource()
+	return source.line, err
+}
+
+// Interprets tokens until the current input source runs out.
+func (c *Compiler) interpretSource() error {
+	for {
+		token, err := c.parser.ReadToken()
+		if err != nil {
+			return err
+		}
+		if token.TokenType == EOF_TOKEN {
+			return nil
+		}
+		if err := c.handleToken(token); err != nil {
+			return err
+		}
+
+		// Control structures outside of definitions get compiled as a whole and then run.
+		if c.anonymous && len(c.control) == 0 {
+			ops, pos := c.current.Ops, c.current.Pos
+			c.endDefinition()
+			if err := c.runChunk(ops, pos); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Words can call other words which are defined further down, but they'd better show up by the end of the batch.
+func (c *Compiler) checkFixups() error {
+	errs := ErrorList{}
+	for _, f := range c.fixups {
+		if f.batch == c.batch {
+			errs = append(errs, c.undefinedWord(f.op))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Complains if we reached the end of the input in the middle of something.
+func (c *Compiler) checkFinished() error {
+	if c.current == nil {
+		return nil
+	}
+	if c.anonymous {
+		open := c.control[0].token
+		return &CompileError{open.Pos, open.Str, "EOF during control structure", THROW_UNEXPECTED_EOF}
+	}
+	return &CompileError{c.current.Pos, c.current.Name, "EOF during word definition", THROW_UNEXPECTED_EOF}
+}
+
+// Interprets or compiles a token, depending on STATE. The word tables it checks (compilerWords, definingWords and
+// inputWords) are filled in by init() rather than declared with their contents, because their handlers end up back
+// here and Go won't allow a variable whose initializer refers to itself.
+func (c *Compiler) handleToken(token Token) error {
+	token = c.canonical(token)
+	if c.current == nil && c.compiling() {
+		// Someone stored to STATE outside of a definition, so there's nothing to compile into.
+		c.setCompiling(false)
+		return &CompileError{token.Pos, "state", "says to compile, but there's no definition to compile into", THROW_COMPILE_ONLY}
+	}
+	if handler, ok := compilerWords[token.Str]; ok && token.TokenType != STRING_TOKEN {
+		return handler(c, token)
+	}
+
+	if returnStackWords[token.Str] && token.TokenType == FUNCALL_TOKEN && (!c.compiling() || c.anonymous) {
+		return &CompileError{token.Pos, token.Str, "can only be used inside a definition", THROW_COMPILE_ONLY}
+	}
+	if !c.compiling() {
+		if definer, ok := definingWords[token.Str]; ok && token.TokenType == FUNCALL_TOKEN {
+			return definer(c, token)
+		}
+		ops, err := c.compileToken(token)
+		if err != nil {
+			return err
+		}
+		return c.runChunk(ops, token.Pos)
+	}
+
+	if address, ok := c.vm.Dict[token.Str]; ok && token.TokenType == FUNCALL_TOKEN && c.immediates[address] {
+		return c.vm.Execute(address)
+	}
+	ops, err := c.compileToken(token)
+	if err != nil {
+		return err
+	}
+	c.emit(ops...)
+	return nil
+}
+
+// Word names get looked up by their Dict key, but the dictionary remembers how they were spelled when they were defined.
+func (c *Compiler) canonical(token Token) Token {
+	if token.TokenType == FUNCALL_TOKEN {
+		token.Str = c.vm.dictKey(token.Str)
+	}
+	return token
+}
+
+// Reports whether STATE says we're compiling.
+func (c *Compiler) compiling() bool {
+	return c.vm.fetchCell(STATE_ADDRESS) != 0
+}
+
+func (c *Compiler) setCompiling(compiling bool) {
+	var state int64
+	if compiling {
+		state = -1
+	}
+	c.vm.storeCell(STATE_ADDRESS, state)
+}
+
+// Adds some ops to the end of the word being compiled.
+func (c *Compiler) emit(ops ...AbstractOp) {
+	c.current.Ops = append(c.current.Ops, ops...)
+}
+
+// Starts compiling a new word.
+func (c *Compiler) beginDefinition(name string, pos Position, anonymous bool) {
+	c.current = &Word{name, []AbstractOp{}, pos}
+	c.anonymous = anonymous
+	c.control = nil
+	c.setCompiling(true)
+}
+
+func (c *Compiler) endDefinition() {
+	c.current = nil
+	c.anonymous = false
+	c.control = nil
+	c.setCompiling(false)
+}
+
+// Turns calls which are the last thing a word does into jumps. A call is in tail position if the next thing is a
+// return, or a jump which ends up at one, like the end of an 'if' branch.
+func (c *Compiler) optimizeTailCalls(ops []AbstractOp) {
+	if c.NoTailCalls {
+		return
+	}
+	for i, op := range ops {
+		if op.Opcode == OP_CALL && returnsFrom(ops, i + 1) {
+			ops[i].Opcode = OP_TAIL_CALL
+		}
+	}
+}
+
+// Returns true if the code starting at ops[i] returns without doing anything else.
+func returnsFrom(ops []AbstractOp, i int) bool {
+	// Jumps could go round in circles ('begin again'), but they can't visit more ops than there are.
+	for steps := 0; i >= 0 && i < len(ops) && steps < len(ops); steps++ {
+		switch ops[i].Opcode {
+		case OP_RETURN:
+			return true
+		case OP_JUMP:
+			i += int(int32(ops[i].Arg))
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// Runs some top-level code immediately, then throws it away again unless it defined new words that came after it.
+func (c *Compiler) runChunk(ops []AbstractOp, pos Position) error {
+	for _, op := range ops {
+		if name, ok := op.Datum.(StringDatum); ok && op.Opcode == OP_CALL {
+			if _, ok := c.vm.Dict[name.Str]; !ok {
+				return c.undefinedWord(op)
+			}
+		}
+	}
+
+	chunk := Word{"top-level code", ops, pos}
+	chunk.Finish(pos)
+	codeSize, heapSize := len(c.vm.Code), len(c.vm.Heap)
+	address := c.pack(chunk.Ops)
+	c.vm.names[address] = chunk.Name
+
+	err := c.vm.Execute(address)
+	if len(c.vm.Code) == codeSize + len(chunk.Ops) {
+		c.vm.Code = c.vm.Code[:codeSize]
+		c.vm.positions = c.vm.positions[:codeSize]
+		c.vm.Heap = c.vm.Heap[:heapSize]
+		delete(c.vm.names, address)
+	}
+	return err
+}
+
+func (c *Compiler) undefinedWord(op AbstractOp) error {
+	name := op.Datum.(StringDatum).Str
+	msg := "undefined word"
+	if suggestion := c.suggest(name); suggestion != "" {
+		msg = fmt.Sprintf("undefined word (did you mean '%s'?)", suggestion)
+	}
+	return &CompileError{op.Pos, name, msg, THROW_UNDEFINED_WORD}
+}
+
+// Finds the known word which is the closest misspelling of the given name, if there's a plausible one.
+func (c *Compiler) suggest(name string) string {
+	candidates := []string{}
+	for candidate := range primitives {
+		candidates = append(candidates, candidate)
+	}
+	for candidate := range compilerWords {
+		candidates = append(candidates, candidate)
+	}
+	for candidate := range definingWords {
+		candidates = append(candidates, candidate)
+	}
+	for candidate := range inputWords {
+		candidates = append(candidates, candidate)
+	}
+	for candidate := range c.vm.Dict {
+		candidates = append(candidates, candidate)
+	}
+	sort.Strings(candidates)
+
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range candidates {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// Plain old Levenshtein distance.
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Throws away any half-compiled state so that a failed LoadCode doesn't poison the next one.
+func (c *Compiler) reset() {
+	c.endDefinition()
+	c.uninstallBroken()
+}
+
+// Compiles the rest of the input into an anonymous word without running it, and returns its ops.
+func (c *Compiler) Compile() ([]AbstractOp, error) {
+	c.beginDefinition("top-level code", c.parser.position(), false)
+	defer c.endDefinition()
+
+	for {
+		token, err := c.parser.ReadToken()
+		if err != nil {
+			return nil, err
+		}
+		if token.TokenType == EOF_TOKEN {
+			break
+		}
+		if err := c.handleToken(token); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.control) > 0 {
+		open := c.control[len(c.control) - 1].token
+		return nil, &CompileError{open.Pos, open.Str, "EOF during control structure", THROW_UNEXPECTED_EOF}
+	}
+	return c.current.Ops, nil
+}
+
+// Returns the execution token of a word, which is just its address in Code. Primitives and defining words don't
+// have one of those, so we make a little word for them the first time someone asks.
+func (c *Compiler) executionToken(name Token) (uint32, error) {
+	if _, ok := compilerWords[name.Str]; ok || returnStackWords[name.Str] || name.TokenType != FUNCALL_TOKEN {
+		return 0, &CompileError{name.Pos, name.Str, "doesn't have an execution token", THROW_INVALID_NAME}
+	}
+	if address, ok := c.stubs[name.Str]; ok {
+		return address, nil
+	}
+
+	isBuiltIn := c.isBuiltIn(name.Str)
+	if address, ok := c.vm.Dict[name.Str]; ok && !isBuiltIn {
+		return address, nil
+	} else if !isBuiltIn {
+		return 0, c.undefinedWord(AbstractOp{OP_CALL, 0, StringDatum{name.Str}, name.Pos})
+	}
+
+	ops, err := c.compileToken(name)
+	if err != nil {
+		return 0, err
+	}
+	stub := Word{name.Str, ops, name.Pos}
+	stub.Finish(name.Pos)
+	address := c.pack(stub.Ops)
+	c.vm.names[address] = name.Str
+	c.stubs[name.Str] = address
+	return address, nil
+}
+
+// Reports whether the compiler handles a word itself instead of looking it up in the dictionary. Words with those
+// names could be defined, but they'd never get called, so we don't let them.
+func (c *Compiler) isBuiltIn(name string) bool {
+	return isBuiltInKey(c.vm.dictKey(name))
+}
+
+// Like isBuiltIn, but for a name that's already been turned into a Dict key.
+func isBuiltInKey(key string) bool {
+	_, isPrimitive := primitives[key]
+	_, isCompilerWord := compilerWords[key]
+	_, isDefiningWord := definingWords[key]
+	_, isInputWord := inputWords[key]
+	return isPrimitive || isCompilerWord || isDefiningWord || isInputWord
+}
+
+func (c *Compiler) checkRedefinition(name Token) error {
+	if c.isBuiltIn(name.Str) {
+		return &CompileError{name.Pos, name.Str, "built into the compiler, so it can't be redefined", THROW_INVALID_NAME}
+	}
+	return nil
+}
+
+// Turns a token into the ops which do what it does, for any token that isn't handled by compilerWords.
+func (c *Compiler) compileToken(token Token) ([]AbstractOp, error) {
+	switch token.TokenType {
+	case KEYWORD_TOKEN:
+		return nil, &CompileError{token.Pos, token.Str, "unknown keyword", THROW_UNDEFINED_WORD}
+
+	case INTEGER_TOKEN:
+		return []AbstractOp{{OP_PUSH, 0, IntegerDatum{token.Int}, token.Pos}}, nil
+
+	case STRING_TOKEN:
+		return []AbstractOp{{OP_PUSH, 0, StringDatum{token.Str}, token.Pos}}, nil
+
+	case FUNCALL_TOKEN:
+		if op, ok := primitives[token.Str]; ok {
+			op.Pos = token.Pos
+			return []AbstractOp{op}, nil
+		} else if _, ok := definingWords[token.Str]; ok {
+			return []AbstractOp{{OP_HOSTCALL, c.definerHostCall(token), VoidDatum{}, token.Pos}}, nil
+		} else if _, ok := inputWords[token.Str]; ok {
+			return []AbstractOp{{OP_HOSTCALL, c.inputHostCall(token), VoidDatum{}, token.Pos}}, nil
+		}
+		return []AbstractOp{{OP_CALL, 0, StringDatum{token.Str}, token.Pos}}, nil
+
+	default:
+		return nil, &CompileError{token.Pos, token.Str, fmt.Sprintf("unknown token type %d", token.TokenType), THROW_INVALID_NAME}
+	}
+}
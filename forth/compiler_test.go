@@ -0,0 +1,563 @@
+package forth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func compareOps(t *testing.T, code string, expected ...AbstractOp) *Compiler {
+	c := NewCompiler(NewVirtualMachine())
+	c.parser.pushReader(strings.NewReader(code), 0)
+
+	actual, err := c.Compile()
+	if err != nil {
+		t.Errorf("Unexpected error compiling %s: %v", code, err)
+	}
+	if len(actual) != len(expected) {
+		t.Errorf("Expected %d ops, but got %d instead", len(expected), len(actual))
+	}
+
+	for i, op := range actual {
+		op.Pos = Position{}
+		if i < len(expected) && op != expected[i] {
+			t.Errorf("AbstractOp %d differs: should be %v, but got %v instead.", i, expected[i], op)
+		}
+	}
+
+	return c
+}
+
+func wordsEqual(one Word, two Word) bool {
+	if one.Name != two.Name || len(one.Ops) != len(two.Ops) {
+		return false
+	}
+
+	for i, op := range one.Ops {
+		other := two.Ops[i]
+		op.Pos, other.Pos = Position{}, Position{}
+		if op != other {
+			return false
+		}
+	}
+
+	return true
+}
+
+func assertCompileError(t *testing.T, code string) *CompileError {
+	c := NewCompiler(NewVirtualMachine())
+	err := c.LoadCode(strings.NewReader(code))
+
+	var compileError *CompileError
+	if !errors.As(err, &compileError) {
+		t.Errorf("Expected a compile error, but got %v instead: %s", err, code)
+	}
+	return compileError
+}
+
+func mustLoad(t *testing.T, c *Compiler, code string) {
+	if err := c.LoadCode(strings.NewReader(code)); err != nil {
+		t.Fatalf("Unexpected error loading %s: %v", code, err)
+	}
+}
+
+func assertPackedOpsEqual(t *testing.T, actual []PackedOp, expected []PackedOp) {
+	if len(actual) != len(expected) {
+		t.Errorf("Size mismatch for packed ops: expected %d but got %d", len(expected), len(actual))
+	}
+
+	for i, op := range actual {
+		if i < len(expected) && op != expected[i] {
+			t.Errorf("Op %d was expected to be %08x, but was %08x", i, expected[i], op)
+		}
+	}
+}
+
+func TestWordCompile(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 . ;")
+
+	if address, ok := c.vm.Dict["foo"]; !ok || address != 0 {
+		t.Errorf("Expected foo to be defined at 0, but got %v", c.vm.Dict)
+	}
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000006, // OP_PRINT
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestWordOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 2 + ; : bar foo . ;")
+
+	if len(c.vm.Dict) != 2 {
+		t.Errorf("Expected 2 entries in the dictionary, but got %d.", len(c.vm.Dict))
+	}
+	if c.vm.Dict["foo"] != 0 {
+		t.Errorf("Expected foo to start at offset 0, but it's at %d.", c.vm.Dict["foo"])
+	}
+	if c.vm.Dict["bar"] != 4 {
+		t.Errorf("Expected bar to start at offset 4, but it's at %d.", c.vm.Dict["bar"])
+	}
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000102, // OP_PUSH 2
+		0x00000007, // OP_ADD
+		0x00000001, // OP_RETURN
+		0x00000003, // OP_CALL 0  [start of bar]
+		0x00000006, // OP_PRINT
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestTopLevelCodeIsDiscarded(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, "1 2 + : foo 3 ; 4")
+
+	if len(c.vm.Code) != 2 || len(c.vm.Heap) != 1 {
+		t.Errorf("Expected only foo to be left in the VM, but got %v and %v", c.vm.Code, c.vm.Heap)
+	}
+	if len(c.vm.dataStack) != 2 {
+		t.Errorf("Expected the top-level code to leave 2 items on the stack, but got %v", c.vm.dataStack)
+	}
+}
+
+func TestComments(t *testing.T) {
+	compareOps(t, "2 ( I like pie ) .", AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}}, AbstractOp{OP_PRINT, 0, VoidDatum{}, Position{}})
+	compareOps(t, "2 ( I like\n pie ) . \\ and cake\n 3", AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}}, AbstractOp{OP_PRINT, 0, VoidDatum{}, Position{}}, AbstractOp{OP_PUSH, 0, IntegerDatum{3}, Position{}})
+}
+
+func TestUnboundedComment(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	c.parser.pushReader(strings.NewReader("1 ( 2"), 0) // Should fail with "no matching ')'" error
+	_, err := c.Compile()
+	var syntaxError *SyntaxError
+	if !errors.As(err, &syntaxError) {
+		t.Errorf("Expected a syntax error, but got %v", err)
+	} else if syntaxError.Pos != (Position{"", 1, 3}) {
+		t.Errorf("Expected the error to point at the '(', but got %v", syntaxError.Pos)
+	}
+}
+
+func TestIfCompile(t *testing.T) {
+	compareOps(t, "1 if 2 then",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_JUMP_IF_NOT, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}},
+	)
+}
+
+func TestIfElseCompile(t *testing.T) {
+	compareOps(t, "1 if 2 else 3 then",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_JUMP_IF_NOT, 3, VoidDatum{}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}},
+			AbstractOp{OP_JUMP, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{3}, Position{}},
+	)
+}
+
+func TestIfOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 if 2 then ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1
+		0x00000305, // OP_JUMP_IF_NOT 3
+		0x00000102, // OP_PUSH 2
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestIfElseOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 if 2 else 3 then ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1
+		0x00000405, // OP_JUMP_IF_NOT 4
+		0x00000102, // OP_PUSH 2
+		0x00000504, // OP_JUMP 5
+		0x00000202, // OP_PUSH 3
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestVariableOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, "variable foo : bar 1 foo ! foo @ ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH <address of foo>  [start of foo]
+		0x00000001, // OP_RETURN
+		0x00000102, // OP_PUSH 1  [start of bar]
+		0x00000003, // OP_CALL 0
+		0x0000000c, // OP_STORE
+		0x00000003, // OP_CALL 0
+		0x0000000d, // OP_FETCH
+		0x00000001, // OP_RETURN
+	})
+
+	if c.vm.Heap[0] != (IntegerDatum{DATA_SPACE_START}) {
+		t.Errorf("Expected foo to be the first cell in the data space, but got %v", c.vm.Heap)
+	}
+}
+
+func TestValueOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, "5 value foo : bar 1 to foo ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH <address of foo>  [start of foo]
+		0x0000000d, // OP_FETCH
+		0x00000001, // OP_RETURN
+		0x00000102, // OP_PUSH 1  [start of bar]
+		0x00000202, // OP_PUSH <address of foo>
+		0x0000000c, // OP_STORE
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestDoesOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": const create , does> @ ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x0000005d, // OP_HOSTCALL 0  [start of const]
+		0x0000004e, // OP_COMMA
+		0x0000045e, // OP_DOES 4
+		0x00000001, // OP_RETURN
+		0x0000000d, // OP_FETCH
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestLiteralCompile(t *testing.T) {
+	compareOps(t, "[ 2 3 + ] literal 1",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{5}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+	)
+}
+
+func TestSettingStateOutsideDefinition(t *testing.T) {
+	for _, code := range []string{"-1 state ! 1 2", ": x -1 state ! ; x 1 2"} {
+		c := NewCompiler(NewVirtualMachine())
+		var compileError *CompileError
+		if err := c.LoadCode(strings.NewReader(code)); !errors.As(err, &compileError) || compileError.Code != THROW_COMPILE_ONLY {
+			t.Errorf("Expected %s to throw %d, but got %v", code, THROW_COMPILE_ONLY, err)
+		}
+		if c.compiling() {
+			t.Errorf("Expected STATE to be reset after %s", code)
+		}
+	}
+
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": x [ -1 state ! ] 1 ; x")
+	if len(c.vm.dataStack) != 1 || c.compiling() {
+		t.Errorf("Expected ']' after storing to STATE to go on compiling x, but got %v", c.vm.dataStack)
+	}
+}
+
+func TestPostponeOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo postpone if postpone dup ; immediate")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x0000005d, // OP_HOSTCALL 0  [start of foo]
+		0x0000015d, // OP_HOSTCALL 1
+		0x00000001, // OP_RETURN
+	})
+	if !c.immediates[0] {
+		t.Errorf("Expected foo to be immediate")
+	}
+}
+
+func TestCompileOnlyWords(t *testing.T) {
+	assertCompileError(t, "5 literal")
+	assertCompileError(t, "postpone dup")
+	assertCompileError(t, "[compile] dup")
+	assertCompileError(t, "[")
+	assertCompileError(t, "]")
+	assertCompileError(t, ": foo postpone 5 ;")
+	assertCompileError(t, ": foo postpone later ; : later 1 ;")
+	assertCompileError(t, "immediate")
+	assertCompileError(t, "['] dup")
+	assertCompileError(t, "' if")
+	assertCompileError(t, "' nothing")
+	assertCompileError(t, "5 value foo ' dup is foo")
+	assertCompileError(t, "defer foo 5 to foo")
+}
+
+func TestBadDefiningWords(t *testing.T) {
+	assertCompileError(t, `variable "foo"`)
+	assertCompileError(t, "variable")
+	assertCompileError(t, "variable foo 1 to foo")
+	assertCompileError(t, "1 to nothing")
+	assertCompileError(t, "does> 1")
+}
+
+func TestSpuriousSemicolon(t *testing.T) {
+	assertCompileError(t, "; foo 1 . ;")
+}
+
+func TestMissingSemicolon(t *testing.T) {
+	assertCompileError(t, ": foo 1 .")
+}
+
+func TestSpuriousElse(t *testing.T) {
+	assertCompileError(t, "1 else .")
+}
+
+func TestSpuriousThen(t *testing.T) {
+	assertCompileError(t, "1 then .")
+}
+
+func TestUnterminatedIf(t *testing.T) {
+	assertCompileError(t, "1 if foo")
+	assertCompileError(t, "1 if foo else bar")
+}
+
+func TestCompileAddition(t *testing.T) {
+	compareOps(t, "foo ( n1 n2 -- n' ) 1 2 + .",
+			AbstractOp{OP_CALL, 0, StringDatum{"foo"}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}},
+			AbstractOp{OP_ADD, 0, VoidDatum{}, Position{}},
+			AbstractOp{OP_PRINT, 0, VoidDatum{}, Position{}},
+	)
+}
+
+func TestCompilePrintString(t *testing.T) {
+	compareOps(t, `"foo" .`,
+			AbstractOp{OP_PUSH, 0, StringDatum{"foo"}, Position{}},
+			AbstractOp{OP_PRINT, 0, VoidDatum{}, Position{}},
+	)
+}
+
+func TestCompileErrorPosition(t *testing.T) {
+	err := assertCompileError(t, ": foo 1\n  2 then ;")
+	if err != nil && (err.Pos != Position{"", 2, 5} || err.Word != "then") {
+		t.Errorf("Compile error has the wrong location: %v", err)
+	}
+}
+
+func TestUndefinedWords(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	err := c.LoadCode(strings.NewReader(": square dup frobnicate ; : foo 1 sqare ;\n: bar dupp ;"))
+
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an error list, but got %v", err)
+	}
+	expected := []CompileError{
+		{Position{"", 1, 14}, "frobnicate", "undefined word", THROW_UNDEFINED_WORD},
+		{Position{"", 1, 35}, "sqare", "undefined word (did you mean 'square'?)", THROW_UNDEFINED_WORD},
+		{Position{"", 2, 7}, "dupp", "undefined word (did you mean 'dup'?)", THROW_UNDEFINED_WORD},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, but got %d: %v", len(expected), len(errs), errs)
+	}
+	for i, e := range errs {
+		if compileError, ok := e.(*CompileError); !ok || *compileError != expected[i] {
+			t.Errorf("Expected error %d to be %v, but got %v", i, expected[i], e)
+		}
+	}
+}
+
+func TestUndefinedWordAtTopLevel(t *testing.T) {
+	err := assertCompileError(t, "1 2 swp")
+	if err != nil && (err.Pos != Position{"", 1, 5} || err.Msg != "undefined word (did you mean 'swap'?)") {
+		t.Errorf("Got the wrong error for an undefined word: %v", err)
+	}
+}
+
+func TestFailedDefinitionsAreNotInstalled(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	if err := c.LoadCode(strings.NewReader(": foo bar ;")); err == nil {
+		t.Fatalf("Expected an error for the undefined word")
+	}
+	if _, ok := c.vm.Dict["foo"]; ok {
+		t.Errorf("Expected foo not to be defined, since it calls an undefined word")
+	}
+
+	// Words which call a broken word go too, but the earlier definition of a name comes back.
+	c = NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 ; : unrelated 2 ;")
+	if err := c.LoadCode(strings.NewReader(": foo 1 / 2 nope ; : bar foo ; : baz 3 ;")); err == nil {
+		t.Fatalf("Expected an error for the undefined word")
+	}
+	if _, ok := c.vm.Dict["bar"]; ok {
+		t.Errorf("Expected bar not to be defined, since it calls foo")
+	}
+	mustLoad(t, c, "foo unrelated baz")
+	if fmt.Sprint(c.vm.dataStack) != fmt.Sprint([]Datum{IntegerDatum{1}, IntegerDatum{2}, IntegerDatum{3}}) {
+		t.Errorf("Expected the old foo and the other words to still work, but got %v", c.vm.dataStack)
+	}
+}
+
+func TestForwardReference(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo bar ; : bar 1 ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x0000027b, // OP_TAIL_CALL 2  [start of foo]
+		0x00000001, // OP_RETURN
+		0x00000002, // OP_PUSH 1  [start of bar]
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestRecurse(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 ; : bar foo recurse ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000001, // OP_RETURN
+		0x00000003, // OP_CALL 0  [start of bar]
+		0x0000027b, // OP_TAIL_CALL 2
+		0x00000001, // OP_RETURN
+	})
+	assertCompileError(t, "recurse")
+	assertCompileError(t, "1 if recurse then")
+}
+
+func TestWordIsHiddenUntilFinished(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 ; : foo foo 1+ ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of the first foo]
+		0x00000001, // OP_RETURN
+		0x00000003, // OP_CALL 0  [start of the second foo]
+		0x0000002e, // OP_ONE_PLUS
+		0x00000001, // OP_RETURN
+	})
+
+	err := assertCompileError(t, ": countdown dup if 1- countdown then ;")
+	expected := CompileError{Position{"", 1, 23}, "countdown", "undefined word (did you mean 'recurse'?)", THROW_UNDEFINED_WORD}
+	if err != nil && *err != expected {
+		t.Errorf("Expected %v, but got %v", expected, err)
+	}
+
+	// A later word with the same name doesn't count, either.
+	c = NewCompiler(NewVirtualMachine())
+	if err := c.LoadCode(strings.NewReader(": foo foo 2 ; : foo 1 ;")); err == nil {
+		t.Errorf("Expected foo's call to itself to be undefined")
+	}
+	if _, ok := c.vm.Dict["foo"]; ok {
+		t.Errorf("Expected foo not to be defined, since the first one failed")
+	}
+}
+
+func TestTailCallsInBranches(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo 1 ; : bar if foo else foo foo then ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000001, // OP_RETURN
+		0x00000505, // OP_JUMP_IF_NOT 5  [start of bar]
+		0x0000007b, // OP_TAIL_CALL 0
+		0x00000704, // OP_JUMP 7
+		0x00000003, // OP_CALL 0
+		0x0000007b, // OP_TAIL_CALL 0
+		0x00000001, // OP_RETURN
+	})
+
+	c = NewCompiler(NewVirtualMachine())
+	c.NoTailCalls = true
+	mustLoad(t, c, ": foo 1 ; : bar foo ;")
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000001, // OP_RETURN
+		0x00000003, // OP_CALL 0  [start of bar]
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestBeginUntilCompile(t *testing.T) {
+	compareOps(t, "begin 1 until",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_JUMP_IF_NOT, backwards(1), VoidDatum{}, Position{}},
+	)
+}
+
+func TestBeginAgainCompile(t *testing.T) {
+	compareOps(t, "begin 1 leave again",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_JUMP, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_JUMP, backwards(2), VoidDatum{}, Position{}},
+	)
+}
+
+func TestBeginWhileRepeatCompile(t *testing.T) {
+	compareOps(t, "begin 1 while 2 if leave then repeat",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{1}, Position{}},
+			AbstractOp{OP_JUMP_IF_NOT, 5, VoidDatum{}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{2}, Position{}},
+			AbstractOp{OP_JUMP_IF_NOT, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_JUMP, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_JUMP, backwards(5), VoidDatum{}, Position{}},
+	)
+}
+
+func TestBeginUntilOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo begin 1 until ; : bar 2 begin 3 until ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x00000002, // OP_PUSH 1  [start of foo]
+		0x00000005, // OP_JUMP_IF_NOT 0
+		0x00000001, // OP_RETURN
+		0x00000102, // OP_PUSH 2  [start of bar]
+		0x00000202, // OP_PUSH 3
+		0x00000405, // OP_JUMP_IF_NOT 4
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestMismatchedLoops(t *testing.T) {
+	assertCompileError(t, "1 until")
+	assertCompileError(t, "begin 1 repeat")
+	assertCompileError(t, "begin 1 while 2 until")
+	assertCompileError(t, "begin 1 if until then")
+	assertCompileError(t, "begin 1")
+	assertCompileError(t, "1 if leave then")
+	assertCompileError(t, "begin : foo leave ; again")
+}
+
+func TestDoLoopCompile(t *testing.T) {
+	compareOps(t, "3 0 do i leave loop",
+			AbstractOp{OP_PUSH, 0, IntegerDatum{3}, Position{}},
+			AbstractOp{OP_PUSH, 0, IntegerDatum{0}, Position{}},
+			AbstractOp{OP_DO, 0, VoidDatum{}, Position{}},
+			AbstractOp{OP_I, 0, VoidDatum{}, Position{}},
+			AbstractOp{OP_UNLOOP, 0, VoidDatum{}, Position{}},
+			AbstractOp{OP_JUMP, 2, VoidDatum{}, Position{}},
+			AbstractOp{OP_LOOP, backwards(3), VoidDatum{}, Position{}},
+	)
+}
+
+func TestQuestionDoPlusLoopOpPacking(t *testing.T) {
+	c := NewCompiler(NewVirtualMachine())
+	mustLoad(t, c, ": foo ?do i 2 +loop ;")
+
+	assertPackedOpsEqual(t, c.vm.Code, []PackedOp{
+		0x0000040f, // OP_QDO 4  [start of foo]
+		0x00000012, // OP_I
+		0x00000002, // OP_PUSH 2
+		0x00000111, // OP_PLUS_LOOP 1
+		0x00000001, // OP_RETURN
+	})
+}
+
+func TestMismatchedDoLoops(t *testing.T) {
+	assertCompileError(t, "1 loop")
+	assertCompileError(t, ": foo 10 0 do i +loop loop ;")
+	assertCompileError(t, ": foo 10 0 do begin i loop until ;")
+	assertCompileError(t, ": foo 10 0 do i ;")
+}
@@ -0,0 +1,247 @@
+package forth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Defining words read the name of a new word from the input and add it to the dictionary straight away (or otherwise
+// change the dictionary), so they're handled by the compiler instead of being compiled into code.
+var definingWords map[string]func(*Compiler, Token) error
+
+func init() {
+	definingWords = map[string]func(*Compiler, Token) error{
+		"variable":  defineVariable,
+		"2variable": defineTwoVariable,
+		"constant":  defineConstant,
+		"2constant": defineTwoConstant,
+		"value":     defineValue,
+		"buffer:":   defineBuffer,
+		"create":    defineCreate,
+		"immediate": makeImmediate,
+		"defer":     defineDefer,
+		"'":         tick,
+	}
+}
+
+// ( "name" -- ) Creates a word which pushes the address of a new cell.
+func defineVariable(c *Compiler, token Token) error {
+	return c.defineData(token, func() int64 { return c.allotAligned(CELL_SIZE) })
+}
+
+// ( "name" -- ) Like 'variable', but with room for a double-cell number.
+func defineTwoVariable(c *Compiler, token Token) error {
+	return c.defineData(token, func() int64 { return c.allotAligned(2 * CELL_SIZE) })
+}
+
+// ( u "name" -- ) Creates a word which pushes the address of a new buffer of u bytes.
+func defineBuffer(c *Compiler, token Token) error {
+	return c.defineData(token, func() int64 {
+		size := c.vm.popInteger()
+		if size < 0 {
+			c.vm.throw(THROW_OUT_OF_RANGE, "can't make a buffer of %d bytes", size)
+		}
+		return c.allotAligned(size)
+	})
+}
+
+// ( x "name" -- ) Creates a word which pushes x.
+func defineConstant(c *Compiler, token Token) error {
+	var x Datum
+	return c.defineWithStack(token, func() { x = c.vm.popDataStack() }, func(name Token) []AbstractOp {
+		return []AbstractOp{{OP_PUSH, 0, x, name.Pos}}
+	})
+}
+
+// ( x1 x2 "name" -- ) Creates a word which pushes x1 and x2.
+func defineTwoConstant(c *Compiler, token Token) error {
+	var x1, x2 Datum
+	return c.defineWithStack(token, func() { x2, x1 = c.vm.popDataStack(), c.vm.popDataStack() }, func(name Token) []AbstractOp {
+		return []AbstractOp{{OP_PUSH, 0, x1, name.Pos}, {OP_PUSH, 0, x2, name.Pos}}
+	})
+}
+
+// ( x "name" -- ) Creates a word which pushes x, which can be changed later with 'to'.
+func defineValue(c *Compiler, token Token) error {
+	var address int64
+	err := c.defineWithStack(token, func() {
+		x := c.vm.popInteger()
+		address = c.allotAligned(CELL_SIZE)
+		c.vm.storeCell(address, x)
+	}, func(name Token) []AbstractOp {
+		return []AbstractOp{{OP_PUSH, 0, IntegerDatum{address}, name.Pos}, {OP_FETCH, 0, VoidDatum{}, name.Pos}}
+	})
+	if err == nil {
+		c.values[c.vm.latest] = address
+	}
+	return err
+}
+
+// ( "name" -- ) Creates a word which pushes the address of the next cell in the data space, which is its body.
+// 'does>' can change what it does afterwards by patching its RETURN into a jump.
+func defineCreate(c *Compiler, token Token) error {
+	var address int64
+	err := c.defineData(token, func() int64 {
+		address = c.allotAligned(0)
+		return address
+	})
+	if err == nil {
+		c.vm.bodies[c.vm.latest] = address
+	}
+	return err
+}
+
+// ( "name" -- ) Creates a word which executes whatever execution token 'is' gives it.
+func defineDefer(c *Compiler, token Token) error {
+	var address int64
+	err := c.defineWithStack(token, func() {
+		address = c.allotAligned(CELL_SIZE)
+		c.vm.storeCell(address, UNSET_DEFER)
+	}, func(name Token) []AbstractOp {
+		return []AbstractOp{
+			{OP_PUSH, 0, IntegerDatum{address}, name.Pos},
+			{OP_FETCH, 0, VoidDatum{}, name.Pos},
+			{OP_EXECUTE, 0, VoidDatum{}, name.Pos},
+		}
+	})
+	if err == nil {
+		c.defers[c.vm.latest] = address
+	}
+	return err
+}
+
+// ( "name" -- xt ) Pushes the execution token of a word.
+func tick(c *Compiler, token Token) error {
+	name, err := c.readWordName(token)
+	if err != nil {
+		return err
+	}
+	xt, err := c.executionToken(name)
+	if err != nil {
+		return err
+	}
+	if runtimeError := c.vm.guard(func() { c.vm.pushInteger(int64(xt)) }); runtimeError != nil {
+		runtimeError.Pos = token.Pos
+		runtimeError.Word = token.Str
+		return runtimeError
+	}
+	return nil
+}
+
+// ( -- ) Makes the most recently defined word run at compile time instead of being compiled.
+func makeImmediate(c *Compiler, token Token) error {
+	if _, ok := c.vm.names[c.vm.latest]; !ok {
+		return &CompileError{token.Pos, token.Str, "no word has been defined yet", THROW_INVALID_NAME}
+	}
+	c.immediates[c.vm.latest] = true
+	return nil
+}
+
+// Compiles code which stores to (or fetches from) the cell behind a word made by 'value' or 'defer'. The table says
+// where those cells are, and definer is the name of the word that should have made it.
+func (c *Compiler) accessOps(token Token, table map[uint32]int64, definer string, opcode uint8) ([]AbstractOp, error) {
+	name, err := c.readName(token)
+	if err != nil {
+		return nil, err
+	}
+	wordAddress, ok := c.vm.Dict[c.vm.dictKey(name.Str)]
+	address, isRightKind := table[wordAddress]
+	if !ok || !isRightKind {
+		return nil, &CompileError{name.Pos, name.Str, fmt.Sprintf("not defined by '%s'", definer), THROW_INVALID_NAME}
+	}
+	return []AbstractOp{
+		{OP_PUSH, 0, IntegerDatum{address}, name.Pos},
+		{opcode, 0, VoidDatum{}, name.Pos},
+	}, nil
+}
+
+// Reads the name of the word that a defining word is about to create.
+func (c *Compiler) readName(token Token) (Token, error) {
+	if c.parser.current() == nil {
+		return Token{}, &CompileError{token.Pos, token.Str, "there's no input to read a name from", THROW_ZERO_LENGTH_NAME}
+	}
+	name, err := c.parser.ReadName()
+	if err != nil {
+		return name, err
+	}
+	if name.TokenType != FUNCALL_TOKEN {
+		return name, &CompileError{token.Pos, token.Str, "expected a name after it", THROW_ZERO_LENGTH_NAME}
+	} else if name.Str[0] == '"' {
+		return name, &CompileError{name.Pos, name.Str, "not a valid word name", THROW_INVALID_NAME}
+	}
+	return name, nil
+}
+
+// Creates a word which pushes the data space address returned by allot.
+func (c *Compiler) defineData(token Token, allot func() int64) error {
+	var address int64
+	return c.defineWithStack(token, func() { address = allot() }, func(name Token) []AbstractOp {
+		return []AbstractOp{{OP_PUSH, 0, IntegerDatum{address}, name.Pos}}
+	})
+}
+
+// Reads a name, runs setup (which may take things off the data stack and throw errors), then defines the name as
+// a word made of the ops returned by body.
+func (c *Compiler) defineWithStack(token Token, setup func(), body func(Token) []AbstractOp) error {
+	name, err := c.readName(token)
+	if err != nil {
+		return err
+	}
+	if err := c.checkRedefinition(name); err != nil {
+		return err
+	}
+	if runtimeError := c.vm.guard(setup); runtimeError != nil {
+		runtimeError.Pos = token.Pos
+		runtimeError.Word = token.Str
+		return runtimeError
+	}
+
+	word := Word{name.Str, body(name), name.Pos}
+	word.Finish(name.Pos)
+	c.install(word)
+	return nil
+}
+
+// Allots some zeroed bytes at the next cell boundary in the data space and returns their address.
+func (c *Compiler) allotAligned(size int64) int64 {
+	c.vm.allot(aligned(c.vm.here()) - c.vm.here())
+	address := c.vm.here()
+	c.vm.allot(size)
+	return address
+}
+
+// Returns the host function which runs a defining word from inside compiled code.
+func (c *Compiler) definerHostCall(token Token) uint32 {
+	definer := definingWords[token.Str]
+	return c.hostCall(token.Str, THROW_INVALID_NAME, func() error { return definer(c, token) })
+}
+
+// Returns the index of a VM host function which calls f, registering it if this is the first time we've seen this
+// key. Compile and syntax errors get turned into throws with their own codes, since there's nobody else to report them
+// to, and anything else gets the given code.
+func (c *Compiler) hostCall(key string, throwCode int, f func() error) uint32 {
+	if index, ok := c.hostCalls[key]; ok {
+		return index
+	}
+
+	index := c.vm.addHostFunction(func() {
+		if err := f(); err != nil {
+			var runtimeError *RuntimeError
+			var compileError *CompileError
+			var syntaxError *SyntaxError
+			var bye *Bye
+			if errors.As(err, &runtimeError) {
+				panic(runtimeError)
+			} else if errors.As(err, &bye) {
+				panic(bye)
+			} else if errors.As(err, &compileError) {
+				c.vm.throw(compileError.Code, "'%s' %s", compileError.Word, compileError.Msg)
+			} else if errors.As(err, &syntaxError) {
+				c.vm.throw(syntaxError.Code, "'%s' %s", syntaxError.Token, syntaxError.Msg)
+			}
+			c.vm.throw(throwCode, "%v", err)
+		}
+	})
+	c.hostCalls[key] = index
+	return index
+}
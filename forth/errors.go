@@ -0,0 +1,130 @@
+package forth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The parser couldn't make sense of the input. Code is the THROW code it turns into if it happens inside 'evaluate'
+// or 'include'.
+type SyntaxError struct {
+	Pos Position
+	Token string
+	Msg string
+	Code int
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%ssyntax error at '%s': %s", e.Pos.prefix(), e.Token, e.Msg)
+}
+
+// The input parsed fine, but the compiler couldn't turn it into code. Code is the same as for SyntaxError.
+type CompileError struct {
+	Pos Position
+	Word string
+	Msg string
+	Code int
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("%scan't compile '%s': %s", e.Pos.prefix(), e.Word, e.Msg)
+}
+
+// The standard ANS Forth THROW codes for things that can go wrong at runtime.
+const (
+	THROW_ABORT = -1
+	THROW_ABORT_QUOTE = -2
+	THROW_STACK_OVERFLOW = -3
+	THROW_STACK_UNDERFLOW = -4
+	THROW_RETURN_STACK_OVERFLOW = -5
+	THROW_RETURN_STACK_UNDERFLOW = -6
+	THROW_DICTIONARY_OVERFLOW = -8
+	THROW_INVALID_ADDRESS = -9
+	THROW_DIVISION_BY_ZERO = -10
+	THROW_OUT_OF_RANGE = -11
+	THROW_TYPE_MISMATCH = -12
+	THROW_UNDEFINED_WORD = -13
+	THROW_COMPILE_ONLY = -14
+	THROW_PICTURED_OUTPUT_OVERFLOW = -17
+	THROW_ZERO_LENGTH_NAME = -16
+	THROW_PARSED_STRING_OVERFLOW = -18
+	THROW_CONTROL_MISMATCH = -22
+	THROW_INVALID_NUMERIC_ARGUMENT = -24
+	THROW_COMPILER_NESTING = -29
+	THROW_NOT_CREATED = -31
+	THROW_INVALID_NAME = -32
+	THROW_FILE_IO = -37
+	THROW_NONEXISTENT_FILE = -38
+	THROW_UNEXPECTED_EOF = -39
+)
+
+// A backslash escape in a string that doesn't make sense. ANS doesn't have a code for it, so it's one of ours (from
+// -256 down; see THROW_HOST_ERROR).
+const THROW_INVALID_ESCAPE = -257
+
+// What 'throw' says when nothing catches one of the standard codes. Anything else is just an uncaught exception.
+var throwMessages = map[int]string{
+	THROW_ABORT: "aborted",
+	THROW_STACK_OVERFLOW: "stack overflow",
+	THROW_STACK_UNDERFLOW: "stack underflow",
+	THROW_RETURN_STACK_OVERFLOW: "return stack overflow",
+	THROW_RETURN_STACK_UNDERFLOW: "return stack underflow",
+	THROW_DICTIONARY_OVERFLOW: "dictionary overflow",
+	THROW_INVALID_ADDRESS: "invalid memory address",
+	THROW_DIVISION_BY_ZERO: "division by zero",
+	THROW_OUT_OF_RANGE: "result out of range",
+	THROW_TYPE_MISMATCH: "argument type mismatch",
+	THROW_UNDEFINED_WORD: "undefined word",
+	THROW_COMPILE_ONLY: "interpreting a compile-only word",
+	THROW_PICTURED_OUTPUT_OVERFLOW: "pictured numeric output string overflow",
+	THROW_ZERO_LENGTH_NAME: "attempt to use zero-length string as a name",
+	THROW_PARSED_STRING_OVERFLOW: "parsed string overflow",
+	THROW_CONTROL_MISMATCH: "control structure mismatch",
+	THROW_COMPILER_NESTING: "compiler nesting",
+	THROW_INVALID_NUMERIC_ARGUMENT: "invalid numeric argument",
+	THROW_NOT_CREATED: "not a word made by 'create'",
+	THROW_INVALID_NAME: "invalid name argument",
+	THROW_FILE_IO: "file I/O exception",
+	THROW_NONEXISTENT_FILE: "non-existent file",
+	THROW_UNEXPECTED_EOF: "unexpected end of file",
+}
+
+func throwMessage(code int) string {
+	if msg, ok := throwMessages[code]; ok {
+		return msg
+	}
+	return "uncaught exception"
+}
+
+// Something went wrong while the virtual machine was running. Word is the name of the word that was executing, and
+// Code is the THROW code for the error.
+type RuntimeError struct {
+	Pos Position
+	Word string
+	Code int
+	Msg string
+}
+
+func (e *RuntimeError) Error() string {
+	return fmt.Sprintf("%sin '%s': %d %s", e.Pos.prefix(), e.Word, e.Code, e.Msg)
+}
+
+// Several errors found in one pass, so that the user can fix them all at once.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// The program asked to stop with the given exit status. It isn't really an error, but it unwinds like one.
+type Bye struct {
+	Code int
+}
+
+func (b *Bye) Error() string {
+	return fmt.Sprintf("bye with exit status %d", b.Code)
+}
@@ -0,0 +1,145 @@
+// Package forth is a little Forth system: a compiler, and a stack-based virtual machine for it to run on. Most
+// programs only need the Forth type, which wraps them both up; the VirtualMachine and Compiler are there if you want
+// to poke around inside.
+package forth
+
+import (
+	"io"
+	"strings"
+)
+
+// A Forth system which Go code can give programs to and trade numbers with.
+type Forth struct {
+	vm *VirtualMachine
+	compiler *Compiler
+}
+
+// Changes something about a Forth system when New makes it.
+type Option func(*options)
+
+type options struct {
+	output io.Writer
+	input io.Reader
+	caseSensitive bool
+	noBuiltins bool
+	noTailCalls bool
+}
+
+// Sends the program's output somewhere other than stdout.
+func WithOutput(output io.Writer) Option {
+	return func(o *options) { o.output = output }
+}
+
+// Reads the program's input from somewhere other than stdin.
+func WithInput(input io.Reader) Option {
+	return func(o *options) { o.input = input }
+}
+
+// Makes DUP and dup different words.
+func CaseSensitive() Option {
+	return func(o *options) { o.caseSensitive = true }
+}
+
+// Leaves out the builtin words which are written in Forth, so that you only get the ones built into the compiler.
+func WithoutBuiltins() Option {
+	return func(o *options) { o.noBuiltins = true }
+}
+
+// Compiles every call as a call, even at the end of a word where it could be a jump. Deep tail recursion will
+// overflow the return stack, but the stack shows every word that's running.
+func WithoutTailCalls() Option {
+	return func(o *options) { o.noTailCalls = true }
+}
+
+// Makes a new Forth system. Each one has its own dictionary, stacks, memory and I/O.
+func New(opts ...Option) *Forth {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	vm := NewVirtualMachine()
+	vm.CaseSensitive = o.caseSensitive
+	if o.output != nil {
+		vm.Output = o.output
+	}
+	if o.input != nil {
+		vm.Input = o.input
+	}
+	f := &Forth{vm, NewCompiler(vm)}
+	f.compiler.NoTailCalls = o.noTailCalls
+	if !o.noBuiltins {
+		if err := f.compiler.LoadBuiltins(); err != nil {
+			panic(err) // They're our own words, so they'd better compile.
+		}
+	}
+	return f
+}
+
+// Interprets some Forth code.
+func (f *Forth) Eval(code string) error {
+	return f.compiler.LoadCode(strings.NewReader(code))
+}
+
+// Interprets Forth code from a reader, such as a file. If it's the same reader as the program's input, they share a
+// buffer, so that 'key' and 'accept' read whatever comes after the current line.
+func (f *Forth) Load(code io.Reader) error {
+	if code == f.vm.Input {
+		code = f.vm.inputReader()
+	}
+	return f.compiler.LoadCode(code)
+}
+
+// Runs an interactive session which reads a line at a time from in, and writes prompts and errors to out.
+func (f *Forth) RunREPL(in io.Reader, out io.Writer) error {
+	return runREPL(f.compiler, in, out)
+}
+
+// Executes a word, with whatever's on the stack.
+func (f *Forth) Call(word string) error {
+	name := f.compiler.canonical(Token{FUNCALL_TOKEN, 0, word, Position{}})
+	xt, err := f.compiler.executionToken(name)
+	if err != nil {
+		return err
+	}
+	return f.vm.Execute(xt)
+}
+
+// Pushes some numbers onto the data stack, in order.
+func (f *Forth) Push(values ...int64) error {
+	for _, value := range values {
+		if err := f.vm.Push(IntegerDatum{value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pops a number off the data stack.
+func (f *Forth) Pop() (int64, error) {
+	var n int64
+	if err := f.vm.guard(func() { n = f.vm.popInteger() }); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Returns how many things are on the data stack.
+func (f *Forth) Depth() int {
+	return len(f.vm.dataStack)
+}
+
+// The virtual machine underneath, for when the methods above aren't enough.
+func (f *Forth) VM() *VirtualMachine {
+	return f.vm
+}
+
+// Likewise for the compiler.
+func (f *Forth) Compiler() *Compiler {
+	return f.compiler
+}
+
+// Defines a word which calls a Go function. See Compiler.Register for how its arguments and results get converted.
+func (f *Forth) Register(name, effect string, fn interface{}) error {
+	return f.compiler.Register(name, effect, fn)
+}
@@ -0,0 +1,192 @@
+package forth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ExampleForth() {
+	f := New()
+	if err := f.Eval(": square ( n -- n*n ) dup * ;"); err != nil {
+		panic(err)
+	}
+	f.Push(7)
+	if err := f.Call("square"); err != nil {
+		panic(err)
+	}
+	n, _ := f.Pop()
+	fmt.Println(n)
+	// Output: 49
+}
+
+func ExampleWithOutput() {
+	var output bytes.Buffer
+	f := New(WithOutput(&output))
+	f.Eval(`." hello" cr`)
+	fmt.Printf("%q\n", output.String())
+	// Output: "hello\n"
+}
+
+func TestForthStack(t *testing.T) {
+	f := New(WithoutBuiltins())
+	if err := f.Push(1, 2, 3); err != nil || f.Depth() != 3 {
+		t.Fatalf("Expected 3 things on the stack, but got %d (%v)", f.Depth(), err)
+	}
+	if err := f.Call("+"); err != nil {
+		t.Errorf("Unexpected error calling a primitive: %v", err)
+	}
+	if n, err := f.Pop(); n != 5 || err != nil {
+		t.Errorf("Expected 5, but got %d (%v)", n, err)
+	}
+	f.Pop()
+
+	var runtimeError *RuntimeError
+	if _, err := f.Pop(); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_STACK_UNDERFLOW {
+		t.Errorf("Expected a stack underflow, but got %v", err)
+	}
+	f.Eval(`"a string"`)
+	if _, err := f.Pop(); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_TYPE_MISMATCH {
+		t.Errorf("Expected a type mismatch, but got %v", err)
+	}
+}
+
+func TestForthCallErrors(t *testing.T) {
+	f := New()
+	var compileError *CompileError
+	if err := f.Call("frobnicate"); !errors.As(err, &compileError) || err.Error() != "can't compile 'frobnicate': undefined word" {
+		t.Errorf("Expected frobnicate to be undefined, with no position, but got %v", err)
+	}
+	if err := f.Call("if"); !errors.As(err, &compileError) {
+		t.Errorf("Expected 'if' not to be callable, but got %v", err)
+	}
+
+	var runtimeError *RuntimeError
+	f.Eval(": divide / ;")
+	f.Push(1, 0)
+	if err := f.Call("DIVIDE"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_DIVISION_BY_ZERO {
+		t.Errorf("Expected a division by zero, but got %v", err)
+	}
+	f.Push(1, 0)
+	if err := f.Call("/"); err == nil || err.Error() != "in '/': -10 division by zero" {
+		t.Errorf("Expected a division by zero with no position, but got %v", err)
+	}
+}
+
+func TestSeparateSystems(t *testing.T) {
+	one, two := New(), New()
+	one.Eval(": foo 1 ;")
+	var compileError *CompileError
+	if err := two.Eval("foo"); !errors.As(err, &compileError) {
+		t.Errorf("Expected foo to be undefined in the other system, but got %v", err)
+	}
+}
+
+func ExampleForth_Register() {
+	f := New()
+	f.Register("shout", "( c-addr u -- c-addr u )", strings.ToUpper)
+	f.Eval(`s" hello" shout type cr`)
+	// Output: HELLO
+}
+
+func TestRegister(t *testing.T) {
+	var output bytes.Buffer
+	f := New(WithOutput(&output))
+	f.Register("hypot2", "( a b -- c )", func(a, b int32) int64 { return int64(a) * int64(a) + int64(b) * int64(b) })
+	f.Register("odd?", "( n -- flag )", func(n uint8) bool { return n % 2 == 1 })
+	f.Register("replicate", "( c-addr u n -- c-addr u )", strings.Repeat)
+	f.Register("swap-datums", "( x1 x2 -- x2 x1 )", func(a, b Datum) (Datum, Datum) { return b, a })
+	f.Register("nothing", "( -- )", func() {})
+
+	if err := f.Eval(`3 4 hypot2 . 7 odd? . 8 odd? . s" ab" 3 replicate type 1 2 swap-datums . . nothing`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "25-10ababab12"; output.String() != expected {
+		t.Errorf("Expected %q, but got %q", expected, output.String())
+	}
+	if f.Depth() != 0 {
+		t.Errorf("Expected an empty stack, but it has %d things on it", f.Depth())
+	}
+
+	// Registered words can be compiled into definitions, too.
+	output.Reset()
+	if err := f.Eval(": sq dup hypot2 ; 3 sq ."); err != nil || output.String() != "18" {
+		t.Errorf("Expected 18, but got %q (%v)", output.String(), err)
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	f := New()
+	var runtimeError *RuntimeError
+	f.Register("fail", "( -- )", func() error { return errors.New("oh no") })
+	if err := f.Call("fail"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_HOST_ERROR || !strings.Contains(err.Error(), "oh no") {
+		t.Errorf("Expected a host error, but got %v", err)
+	}
+	f.Register("fail-nicely", "( n -- n )", func(n int64) (int64, error) {
+		if n < 0 {
+			return 0, &RuntimeError{Code: THROW_INVALID_NUMERIC_ARGUMENT, Msg: "negative"}
+		}
+		return n, nil
+	})
+	f.Push(-1)
+	if err := f.Call("fail-nicely"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_INVALID_NUMERIC_ARGUMENT {
+		t.Errorf("Expected an invalid numeric argument, but got %v", err)
+	}
+	f.Register("byte", "( c -- c )", func(c uint8) uint8 { return c })
+	f.Push(256)
+	if err := f.Call("byte"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_OUT_OF_RANGE {
+		t.Errorf("Expected an out-of-range error, but got %v", err)
+	}
+	if err := f.Call("byte"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_STACK_UNDERFLOW {
+		t.Errorf("Expected a stack underflow, but got %v", err)
+	}
+	f.Register("nil-datum", "( -- x )", func() Datum { return nil })
+	if err := f.Call("nil-datum"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_HOST_ERROR {
+		t.Errorf("Expected a nil Datum to be a host error, but got %v", err)
+	}
+	f.Register("panicky", "( -- )", func() { panic("kaboom") })
+	if err := f.Eval(": try ['] panicky catch ; try"); err != nil {
+		t.Errorf("Expected a panic to be caught, but got %v", err)
+	} else if n, _ := f.Pop(); n != THROW_HOST_ERROR {
+		t.Errorf("Expected a panic to throw %d, but got %d", THROW_HOST_ERROR, n)
+	}
+	if err := f.Call("panicky"); !errors.As(err, &runtimeError) || !strings.Contains(err.Error(), "kaboom") {
+		t.Errorf("Expected a host error about the panic, but got %v", err)
+	}
+
+	var compileError *CompileError
+	badRegistrations := []struct {
+		effect string
+		fn interface{}
+	}{
+		{"( n -- n )", 42},
+		{"n n", func(a, b int) {}},
+		{"( n -- n )", func(a, b int) int { return a }},
+		{"( n -- )", func(s string) {}},
+		{"( x -- )", func(f float64) {}},
+		{"( -- x )", func() []byte { return nil }},
+	}
+	for _, bad := range badRegistrations {
+		if err := f.Register("bad", bad.effect, bad.fn); !errors.As(err, &compileError) {
+			t.Errorf("Expected registering %T with %q to fail, but got %v", bad.fn, bad.effect, err)
+		}
+	}
+	for _, name := range []string{"emit", "DUP", "if", "variable", "include"} {
+		if err := f.Register(name, "( -- )", func() {}); !errors.As(err, &compileError) || compileError.Code != THROW_INVALID_NAME {
+			t.Errorf("Expected registering %s to fail, since it's built in, but got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "has space", "tab\there", `"quoted`} {
+		if err := f.Register(name, "( -- )", func() {}); !errors.As(err, &compileError) {
+			t.Errorf("Expected registering %q to fail, since it can't be called, but got %v", name, err)
+		}
+	}
+	if _, ok := f.vm.Dict["has space"]; ok {
+		t.Errorf("Expected 'has space' not to be defined")
+	}
+	if err := f.Eval("bad"); !errors.As(err, &compileError) {
+		t.Errorf("Expected 'bad' to be undefined, but got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package forth
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// What a registered Go function throws when it returns an error that isn't already a RuntimeError. Codes from -256
+// down are for the system to define as it likes.
+const THROW_HOST_ERROR = -256
+
+var (
+	datumType = reflect.TypeOf((*Datum)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Defines a word which calls a Go function. Its parameters come off the stack (so the last one is the top of the
+// stack) and its results get pushed in order. Integers of any size, bools (as flags) and Datums are passed as they
+// are; strings are a c-addr u pair, and strings it returns only last as long as the ones 's"' makes when it's
+// interpreted. If its last result is an error, it gets thrown instead of pushed.
+//
+// The stack effect, like "( n1 n2 -- n3 )", has to say how many cells the function takes and leaves, so that
+// mistakes show up now instead of when the word gets run.
+func (c *Compiler) Register(name, effect string, fn interface{}) error {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return &CompileError{Position{}, name, fmt.Sprintf("can't register a %T as a word", fn), THROW_HOST_ERROR}
+	}
+	if err := checkHostName(name); err != nil {
+		return err
+	}
+	if err := c.checkRedefinition(Token{FUNCALL_TOKEN, 0, name, Position{}}); err != nil {
+		return err
+	}
+	inputs, outputs, err := parseStackEffect(name, effect)
+	if err != nil {
+		return err
+	}
+
+	fnType := value.Type()
+	params := make([]reflect.Type, fnType.NumIn())
+	for i := range params {
+		params[i] = fnType.In(i)
+	}
+	results := make([]reflect.Type, fnType.NumOut())
+	for i := range results {
+		results[i] = fnType.Out(i)
+	}
+	returnsError := len(results) > 0 && results[len(results) - 1] == errorType
+	if returnsError {
+		results = results[:len(results) - 1]
+	}
+
+	paramCells, err := stackCells(name, params)
+	if err != nil {
+		return err
+	}
+	resultCells, err := stackCells(name, results)
+	if err != nil {
+		return err
+	}
+	if paramCells != inputs || resultCells != outputs {
+		msg := fmt.Sprintf("stack effect %s doesn't match a function which takes %d cells and leaves %d", effect, paramCells, resultCells)
+		return &CompileError{Position{}, name, msg, THROW_HOST_ERROR}
+	}
+
+	index := c.vm.addHostFunction(func() {
+		defer c.recoverHostPanic()
+		args := make([]reflect.Value, len(params))
+		for i := len(params) - 1; i >= 0; i-- {
+			args[i] = c.popArgument(params[i])
+		}
+		values := value.Call(args)
+		if returnsError {
+			c.throwHostError(values[len(values) - 1])
+			values = values[:len(values) - 1]
+		}
+		for _, result := range values {
+			c.pushResult(result)
+		}
+	})
+
+	word := Word{name, []AbstractOp{{OP_HOSTCALL, index, VoidDatum{}, Position{}}}, Position{}}
+	word.Finish(Position{})
+	c.install(word)
+	return nil
+}
+
+// Makes sure that the parser would read a name as a single word, since there'd be no way to call it otherwise.
+func checkHostName(name string) error {
+	if name == "" {
+		return &CompileError{Position{}, name, "a word needs a name", THROW_ZERO_LENGTH_NAME}
+	}
+	for i := 0; i < len(name); i++ {
+		if isDelimiter(name[i], ' ') {
+			return &CompileError{Position{}, name, "word names can't have spaces in them", THROW_INVALID_NAME}
+		}
+	}
+	if name[0] == '"' {
+		return &CompileError{Position{}, name, "names starting with '\"' get read as strings", THROW_INVALID_NAME}
+	}
+	return nil
+}
+
+// Counts the items on each side of the "--" in a stack comment.
+func parseStackEffect(name, effect string) (int, int, error) {
+	items := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(effect), "("), ")"))
+	for i, item := range items {
+		if item == "--" {
+			return i, len(items) - i - 1, nil
+		}
+	}
+	return 0, 0, &CompileError{Position{}, name, fmt.Sprintf("stack effect %q has no '--' in it", effect), THROW_HOST_ERROR}
+}
+
+// Returns how many cells some Go types take up on the stack.
+func stackCells(name string, types []reflect.Type) (int, error) {
+	cells := 0
+	for _, t := range types {
+		switch {
+		case t.Kind() == reflect.String:
+			cells += 2
+		case t == datumType, t.Kind() == reflect.Bool, isInteger(t):
+			cells++
+		default:
+			return 0, &CompileError{Position{}, name, fmt.Sprintf("can't pass a %s to or from Forth", t), THROW_HOST_ERROR}
+		}
+	}
+	return cells, nil
+}
+
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// Pops whatever a Go function wants as its next argument, converting it to the right type.
+func (c *Compiler) popArgument(t reflect.Type) reflect.Value {
+	value := reflect.New(t).Elem()
+	switch {
+	case t == datumType:
+		value.Set(reflect.ValueOf(c.vm.popDataStack()))
+	case t.Kind() == reflect.String:
+		length, address := c.vm.popInteger(), c.vm.popInteger()
+		value.SetString(string(c.vm.memory(address, length)))
+	case t.Kind() == reflect.Bool:
+		value.SetBool(c.vm.popInteger() != 0)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		n := c.vm.popInteger()
+		if value.OverflowInt(n) {
+			c.vm.throw(THROW_OUT_OF_RANGE, "%d doesn't fit in a %s", n, t)
+		}
+		value.SetInt(n)
+	default:
+		// Cells are unsigned if you want them to be, so -1 is a perfectly good uint64.
+		n := c.vm.popInteger()
+		if value.OverflowUint(uint64(n)) {
+			c.vm.throw(THROW_OUT_OF_RANGE, "%d doesn't fit in a %s", n, t)
+		}
+		value.SetUint(uint64(n))
+	}
+	return value
+}
+
+// Pushes something that a Go function returned.
+func (c *Compiler) pushResult(value reflect.Value) {
+	switch {
+	case value.Type() == datumType:
+		if value.IsNil() {
+			c.vm.throw(THROW_HOST_ERROR, "returned a nil Datum")
+		}
+		c.vm.pushDataStack(value.Interface().(Datum))
+	case value.Kind() == reflect.String:
+		str := value.String()
+		if len(str) > TRANSIENT_BUFFER_SIZE {
+			c.vm.throw(THROW_OUT_OF_RANGE, "string is longer than %d bytes", TRANSIENT_BUFFER_SIZE)
+		}
+		c.vm.pushInteger(c.transientString(str))
+		c.vm.pushInteger(int64(len(str)))
+	case value.Kind() == reflect.Bool:
+		c.vm.pushFlag(value.Bool())
+	case value.Kind() >= reflect.Int && value.Kind() <= reflect.Int64:
+		c.vm.pushInteger(value.Int())
+	default:
+		c.vm.pushInteger(int64(value.Uint()))
+	}
+}
+
+// Turns an error that a Go function returned into a throw. RuntimeErrors keep their codes, so Go code can throw
+// whatever it likes.
+func (c *Compiler) throwHostError(value reflect.Value) {
+	if value.IsNil() {
+		return
+	}
+	err := value.Interface().(error)
+	var runtimeError *RuntimeError
+	if errors.As(err, &runtimeError) {
+		c.vm.throw(runtimeError.Code, "%s", runtimeError.Msg)
+	}
+	c.vm.throw(THROW_HOST_ERROR, "%v", err)
+}
+
+// Turns a panic in a Go function into a throw, so that it doesn't take the whole program down with it. Throws and
+// 'bye' are how the VM unwinds, so those get through.
+func (c *Compiler) recoverHostPanic() {
+	r := recover()
+	switch r.(type) {
+	case nil:
+		return
+	case *RuntimeError, *Bye:
+		panic(r)
+	}
+	c.vm.throw(THROW_HOST_ERROR, "panicked: %v", r)
+}
@@ -0,0 +1,609 @@
+package forth
+
+import (
+	"fmt"
+)
+
+// Words which the compiler handles itself whether it's compiling or interpreting, like control structures. They're
+// all immediate, so 'postpone' can be used to build new ones.
+var compilerWords map[string]func(*Compiler, Token) error
+
+func init() {
+	compilerWords = map[string]func(*Compiler, Token) error{
+		":":         defineWord,
+		";":         endWord,
+		"if":        compileIf,
+		"else":      compileElse,
+		"then":      compileThen,
+		"begin":     compileBegin,
+		"until":     compileUntil,
+		"again":     compileAgain,
+		"while":     compileWhile,
+		"repeat":    compileRepeat,
+		"do":        compileDo,
+		"?do":       compileDo,
+		"loop":      compileLoop,
+		"+loop":     compileLoop,
+		"leave":     compileLeave,
+		"does>":     compileDoes,
+		"recurse":   compileRecurse,
+		"to":        compileValueChange,
+		"is":        compileIs,
+		"action-of": compileActionOf,
+		"[']":       compileBracketTick,
+		"literal":   compileLiteral,
+		"postpone":  compilePostpone,
+		"[compile]": compileBracketCompile,
+		`s"`:        compileString,
+		`s\"`:       compileString,
+		`c"`:        compileCountedString,
+		`."`:        compilePrintString,
+		`abort"`:    compileAbortQuote,
+		"[":         leftBracket,
+		"]":         rightBracket,
+		"(":         comment,
+		"\\":        lineComment,
+	}
+}
+
+// An unfinished control structure. Index is the op which started it, which may need patching once we know where
+// it ends, and leaves are the 'leave' jumps which need to go to the end of the loop.
+type controlEntry struct {
+	token Token
+	index int
+	leaves []int
+}
+
+func defineWord(c *Compiler, colon Token) error {
+	if c.current != nil {
+		return &CompileError{colon.Pos, colon.Str, "can't nest word definitions", THROW_COMPILER_NESTING}
+	}
+
+	nameToken, err := c.parser.ReadName()
+	if err != nil {
+		return err
+	}
+	if nameToken.TokenType == EOF_TOKEN {
+		return &CompileError{colon.Pos, colon.Str, "expected a name after it", THROW_ZERO_LENGTH_NAME}
+	} else if nameToken.Str[0] == '"' {
+		return &CompileError{nameToken.Pos, nameToken.Str, "not a valid word name", THROW_INVALID_NAME}
+	} else if err := c.checkRedefinition(nameToken); err != nil {
+		return err
+	}
+	c.beginDefinition(nameToken.Str, nameToken.Pos, false)
+	return nil
+}
+
+func endWord(c *Compiler, semicolon Token) error {
+	if c.current == nil || c.anonymous {
+		return &CompileError{semicolon.Pos, semicolon.Str, "can't use ';' outside of a word definition", THROW_CONTROL_MISMATCH}
+	}
+	if len(c.control) > 0 {
+		open := c.control[len(c.control) - 1].token
+		return &CompileError{open.Pos, open.Str, "not terminated before ';'", THROW_CONTROL_MISMATCH}
+	}
+
+	word := *c.current
+	if err := c.checkSelfReference(word); err != nil {
+		return err
+	}
+	word.Finish(semicolon.Pos)
+	c.optimizeTailCalls(word.Ops)
+	c.endDefinition()
+	c.install(word)
+	return nil
+}
+
+// Like ANS says, a word can't see itself until it's finished, so using its own name inside it means whichever word
+// had that name before. If there wasn't one, it's undefined; otherwise a later word with the same name would fill it
+// in. 'recurse' is how you call yourself.
+func (c *Compiler) checkSelfReference(word Word) error {
+	key := c.vm.dictKey(word.Name)
+	if _, ok := c.vm.Dict[key]; ok {
+		return nil
+	}
+	for _, op := range word.Ops {
+		if name, ok := op.Datum.(StringDatum); ok && op.Opcode == OP_CALL && name.Str == key {
+			return &CompileError{op.Pos, name.Str, "undefined word (did you mean 'recurse'?)", THROW_UNDEFINED_WORD}
+		}
+	}
+	return nil
+}
+
+func compileIf(c *Compiler, token Token) error {
+	if err := c.openControl(token); err != nil {
+		return err
+	}
+	c.pushControl(token, AbstractOp{OP_JUMP_IF_NOT, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+func compileElse(c *Compiler, token Token) error {
+	entry, err := c.popControl(token, "no matching 'if'", "if")
+	if err != nil {
+		return err
+	}
+	c.pushControl(token, AbstractOp{OP_JUMP, 0, VoidDatum{}, token.Pos})
+	c.resolve(entry.index)
+	return nil
+}
+
+func compileThen(c *Compiler, token Token) error {
+	entry, err := c.popControl(token, "no matching 'if'", "if", "else")
+	if err != nil {
+		return err
+	}
+	c.resolve(entry.index)
+	return nil
+}
+
+func compileBegin(c *Compiler, token Token) error {
+	if err := c.openControl(token); err != nil {
+		return err
+	}
+	c.control = append(c.control, controlEntry{token, len(c.current.Ops), nil})
+	return nil
+}
+
+func compileUntil(c *Compiler, token Token) error {
+	return c.closeBegin(token, OP_JUMP_IF_NOT)
+}
+
+func compileAgain(c *Compiler, token Token) error {
+	return c.closeBegin(token, OP_JUMP)
+}
+
+func compileWhile(c *Compiler, token Token) error {
+	if len(c.control) == 0 || c.control[len(c.control) - 1].token.Str != "begin" {
+		return &CompileError{token.Pos, token.Str, "no matching 'begin'", THROW_CONTROL_MISMATCH}
+	}
+	c.pushControl(token, AbstractOp{OP_JUMP_IF_NOT, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+func compileRepeat(c *Compiler, token Token) error {
+	while, err := c.popControl(token, "no matching 'while'", "while")
+	if err != nil {
+		return err
+	}
+	if err := c.closeBegin(token, OP_JUMP); err != nil {
+		return err
+	}
+	c.resolve(while.index)
+	return nil
+}
+
+// Counted loops keep their index and limit on the return stack until they finish.
+func compileDo(c *Compiler, token Token) error {
+	if err := c.openControl(token); err != nil {
+		return err
+	}
+	if token.Str == "?do" {
+		c.pushControl(token, AbstractOp{OP_QDO, 0, VoidDatum{}, token.Pos})
+	} else {
+		c.pushControl(token, AbstractOp{OP_DO, 0, VoidDatum{}, token.Pos})
+	}
+	return nil
+}
+
+func compileLoop(c *Compiler, token Token) error {
+	entry, err := c.popControl(token, "no matching 'do'", "do", "?do")
+	if err != nil {
+		return err
+	}
+
+	opcode := OP_LOOP
+	if token.Str == "+loop" {
+		opcode = OP_PLUS_LOOP
+	}
+	distance := len(c.current.Ops) - entry.index - 1
+	c.emit(AbstractOp{uint8(opcode), backwards(distance), VoidDatum{}, token.Pos})
+	if entry.token.Str == "?do" {
+		c.resolve(entry.index)
+	}
+	c.resolveLeaves(entry)
+	return nil
+}
+
+// Like ANS says, 'leave' leaves the innermost counted loop, even from inside a 'begin' loop. If there isn't a counted
+// loop, it leaves the innermost 'begin' loop instead.
+func compileLeave(c *Compiler, token Token) error {
+	loop := c.innermostControl("do", "?do")
+	if loop >= 0 {
+		c.emit(AbstractOp{OP_UNLOOP, 0, VoidDatum{}, token.Pos})
+	} else if loop = c.innermostControl("begin"); loop < 0 {
+		return &CompileError{token.Pos, token.Str, "can't use 'leave' outside of a loop", THROW_CONTROL_MISMATCH}
+	}
+	c.control[loop].leaves = append(c.control[loop].leaves, len(c.current.Ops))
+	c.emit(AbstractOp{OP_JUMP, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+// Returns the index in c.control of the innermost control structure of one of the given kinds, or -1 if there isn't
+// one.
+func (c *Compiler) innermostControl(kinds ...string) int {
+	for i := len(c.control) - 1; i >= 0; i-- {
+		for _, kind := range kinds {
+			if c.control[i].token.Str == kind {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Everything after does> becomes the code for the words that this word creates.
+func compileDoes(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	c.emit(AbstractOp{OP_DOES, 2, VoidDatum{}, token.Pos}, AbstractOp{OP_RETURN, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+// ( -- ) Calls the word that's being defined, which can't be called by name until it's finished.
+func compileRecurse(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	c.emit(AbstractOp{OP_CALL, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+// ( x "name" -- ) Changes the number that a word created by 'value' pushes.
+func compileValueChange(c *Compiler, token Token) error {
+	return c.compileAccess(c.accessOps(token, c.values, "value", OP_STORE))
+}
+
+// ( xt "name" -- ) Changes what a word created by 'defer' does.
+func compileIs(c *Compiler, token Token) error {
+	return c.compileAccess(c.accessOps(token, c.defers, "defer", OP_STORE))
+}
+
+// ( "name" -- xt ) Pushes the execution token which a word created by 'defer' currently executes.
+func compileActionOf(c *Compiler, token Token) error {
+	return c.compileAccess(c.accessOps(token, c.defers, "defer", OP_FETCH))
+}
+
+// Compiles the code from accessOps into the current definition, or runs it straight away if we're interpreting.
+func (c *Compiler) compileAccess(ops []AbstractOp, err error) error {
+	if err != nil {
+		return err
+	}
+	if c.current != nil && c.compiling() {
+		c.emit(ops...)
+		return nil
+	}
+	return c.runChunk(ops, ops[0].Pos)
+}
+
+// ( -- xt ) Compiles the execution token of the next word as a literal.
+func compileBracketTick(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	name, err := c.readWordName(token)
+	if err != nil {
+		return err
+	}
+	xt, err := c.executionToken(name)
+	if err != nil {
+		return err
+	}
+	c.emit(AbstractOp{OP_PUSH, 0, IntegerDatum{int64(xt)}, name.Pos})
+	return nil
+}
+
+// ( x -- ) Compiles code which pushes x.
+func compileLiteral(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+
+	var x Datum
+	if runtimeError := c.vm.guard(func() { x = c.vm.popDataStack() }); runtimeError != nil {
+		runtimeError.Pos = token.Pos
+		runtimeError.Word = token.Str
+		return runtimeError
+	}
+	c.emit(AbstractOp{OP_PUSH, 0, x, token.Pos})
+	return nil
+}
+
+// Makes the word being defined do what the next word would have done if it had been compiled normally.
+func compilePostpone(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	name, err := c.readWordName(token)
+	if err != nil {
+		return err
+	}
+	return c.postpone(name)
+}
+
+// Like 'postpone', but ordinary words just get compiled straight away.
+func compileBracketCompile(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	name, err := c.readWordName(token)
+	if err != nil {
+		return err
+	}
+	if c.isImmediate(name) {
+		return c.postpone(name)
+	}
+	ops, err := c.compileToken(name)
+	if err != nil {
+		return err
+	}
+	c.emit(ops...)
+	return nil
+}
+
+// ( "ccc<quote>" -- c-addr u ) Pushes the address and length of a string. Compiled strings live in the data
+// space; interpreted ones only last until the next-but-one interpreted string.
+func compileString(c *Compiler, token Token) error {
+	str, err := c.parser.ParseString(token.Str, token.Str == `s\"`)
+	if err != nil {
+		return err
+	}
+
+	if c.current != nil && c.compiling() {
+		address, err := c.storeString(token, str, false)
+		if err != nil {
+			return err
+		}
+		c.emit(AbstractOp{OP_PUSH, 0, IntegerDatum{address}, token.Pos})
+		c.emit(AbstractOp{OP_PUSH, 0, IntegerDatum{int64(len(str))}, token.Pos})
+		return nil
+	}
+
+	if len(str) > TRANSIENT_BUFFER_SIZE {
+		return &CompileError{token.Pos, token.Str, fmt.Sprintf("string is longer than %d bytes", TRANSIENT_BUFFER_SIZE), THROW_PARSED_STRING_OVERFLOW}
+	}
+	address := c.transientString(str)
+	return c.runChunk([]AbstractOp{
+		{OP_PUSH, 0, IntegerDatum{address}, token.Pos},
+		{OP_PUSH, 0, IntegerDatum{int64(len(str))}, token.Pos},
+	}, token.Pos)
+}
+
+// ( "ccc<quote>" -- c-addr ) Compiles the address of a counted string, which starts with its length.
+func compileCountedString(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	str, err := c.parser.ParseString(token.Str, false)
+	if err != nil {
+		return err
+	}
+	address, err := c.storeString(token, str, true)
+	if err != nil {
+		return err
+	}
+	c.emit(AbstractOp{OP_PUSH, 0, IntegerDatum{address}, token.Pos})
+	return nil
+}
+
+// ( "ccc<quote>" -- ) Prints a string. If we're not compiling, it gets printed straight away.
+func compilePrintString(c *Compiler, token Token) error {
+	str, err := c.parser.ParseString(token.Str, false)
+	if err != nil {
+		return err
+	}
+	ops := []AbstractOp{{OP_PUSH, 0, StringDatum{str}, token.Pos}, {OP_PRINT, 0, VoidDatum{}, token.Pos}}
+	if c.current != nil && c.compiling() {
+		c.emit(ops...)
+		return nil
+	}
+	return c.runChunk(ops, token.Pos)
+}
+
+// ( i*x x1 "ccc<quote>" -- | i*x ) Throws -2 with the string as its message if x1 isn't zero.
+func compileAbortQuote(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	str, err := c.parser.ParseString(token.Str, false)
+	if err != nil {
+		return err
+	}
+	c.emit(AbstractOp{OP_PUSH, 0, StringDatum{str}, token.Pos}, AbstractOp{OP_ABORT_QUOTE, 0, VoidDatum{}, token.Pos})
+	return nil
+}
+
+// Copies a string into whichever transient buffer is next, and returns its address. It had better fit.
+func (c *Compiler) transientString(str string) int64 {
+	address := int64(TRANSIENT_BUFFERS + c.transientBuffer * TRANSIENT_BUFFER_SIZE)
+	c.transientBuffer = 1 - c.transientBuffer
+	copy(c.vm.Memory[address:], str)
+	return address
+}
+
+// Copies a string into the data space, optionally preceded by a length byte, and returns its address.
+func (c *Compiler) storeString(token Token, str string, counted bool) (int64, error) {
+	if counted && len(str) > 255 {
+		return 0, &CompileError{token.Pos, token.Str, "counted strings can't be longer than 255 bytes", THROW_PARSED_STRING_OVERFLOW}
+	}
+
+	var address int64
+	runtimeError := c.vm.guard(func() {
+		address = c.vm.here()
+		if counted {
+			c.vm.allot(1)
+			c.vm.Memory[address] = byte(len(str))
+		}
+		c.vm.allot(int64(len(str)))
+		copy(c.vm.Memory[c.vm.here() - int64(len(str)):], str)
+	})
+	if runtimeError != nil {
+		runtimeError.Pos = token.Pos
+		runtimeError.Word = token.Str
+		return 0, runtimeError
+	}
+	return address, nil
+}
+
+// ( "ccc<paren>" -- ) A comment. Unlike most parsing words, it can carry on over several lines.
+func comment(c *Compiler, token Token) error {
+	found, err := c.parser.skipPast(')')
+	if err == nil && !found {
+		return &SyntaxError{token.Pos, token.Str, "no matching ')' for '('", THROW_UNEXPECTED_EOF}
+	}
+	return err
+}
+
+// ( "ccc<eol>" -- ) A comment which goes to the end of the line.
+func lineComment(c *Compiler, token Token) error {
+	_, length := c.vm.source()
+	c.vm.storeCell(TO_IN_ADDRESS, length)
+	return nil
+}
+
+// Switches to interpreting in the middle of a definition.
+func leftBracket(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	c.setCompiling(false)
+	return nil
+}
+
+// Goes back to compiling the definition that '[' interrupted.
+func rightBracket(c *Compiler, token Token) error {
+	if err := c.requireDefinition(token); err != nil {
+		return err
+	}
+	c.setCompiling(true)
+	return nil
+}
+
+func (c *Compiler) requireDefinition(token Token) error {
+	if c.current == nil || c.anonymous {
+		return &CompileError{token.Pos, token.Str, "can only be used inside a definition", THROW_COMPILE_ONLY}
+	}
+	return nil
+}
+
+// Starts a control structure. If we're not inside a definition, we compile it into some anonymous code which gets
+// run as soon as it's finished.
+func (c *Compiler) openControl(token Token) error {
+	if c.current == nil {
+		c.beginDefinition("top-level code", token.Pos, true)
+	} else if !c.compiling() {
+		return &CompileError{token.Pos, token.Str, "can't be used while interpreting inside a definition", THROW_COMPILE_ONLY}
+	}
+	return nil
+}
+
+// Emits an op which will need patching later and remembers where it is.
+func (c *Compiler) pushControl(token Token, op AbstractOp) {
+	c.control = append(c.control, controlEntry{token, len(c.current.Ops), nil})
+	c.emit(op)
+}
+
+// Finishes the innermost control structure, which had better be one of the given kinds.
+func (c *Compiler) popControl(token Token, msg string, kinds ...string) (controlEntry, error) {
+	if len(c.control) > 0 {
+		entry := c.control[len(c.control) - 1]
+		for _, kind := range kinds {
+			if entry.token.Str == kind {
+				c.control = c.control[:len(c.control) - 1]
+				return entry, nil
+			}
+		}
+	}
+	return controlEntry{}, &CompileError{token.Pos, token.Str, msg, THROW_CONTROL_MISMATCH}
+}
+
+// Makes the jump at the given index go to the next op to be compiled.
+func (c *Compiler) resolve(index int) {
+	c.current.Ops[index].Arg = uint32(len(c.current.Ops) - index)
+}
+
+// Any 'leave's which belong to this loop jump to just past the end of it.
+func (c *Compiler) resolveLeaves(entry controlEntry) {
+	for _, index := range entry.leaves {
+		c.resolve(index)
+	}
+}
+
+func (c *Compiler) closeBegin(token Token, opcode uint8) error {
+	entry, err := c.popControl(token, "no matching 'begin'", "begin")
+	if err != nil {
+		return err
+	}
+	c.emit(AbstractOp{opcode, backwards(len(c.current.Ops) - entry.index), VoidDatum{}, token.Pos})
+	c.resolveLeaves(entry)
+	return nil
+}
+
+// Jump offsets are relative to the jump instruction, so backwards jumps are negative numbers in disguise.
+func backwards(distance int) uint32 {
+	return uint32(-distance)
+}
+
+// Reads the name of an existing word, which might be a keyword.
+func (c *Compiler) readWordName(token Token) (Token, error) {
+	if c.parser.current() == nil {
+		return Token{}, &CompileError{token.Pos, token.Str, "there's no input to read a name from", THROW_ZERO_LENGTH_NAME}
+	}
+	name, err := c.parser.ReadToken()
+	if err != nil {
+		return name, err
+	}
+	if name.TokenType != FUNCALL_TOKEN && name.TokenType != KEYWORD_TOKEN {
+		return name, &CompileError{token.Pos, token.Str, "expected the name of a word after it", THROW_ZERO_LENGTH_NAME}
+	}
+	return c.canonical(name), nil
+}
+
+func (c *Compiler) isImmediate(name Token) bool {
+	if _, ok := compilerWords[name.Str]; ok {
+		return true
+	}
+	address, ok := c.vm.Dict[name.Str]
+	return ok && c.immediates[address]
+}
+
+// Compiles code which will do what the named word does when it's compiled. For ordinary words that means compiling
+// them, and for immediate words it means running them.
+func (c *Compiler) postpone(name Token) error {
+	if handler, ok := compilerWords[name.Str]; ok {
+		index := c.hostCall("postpone " + name.Str, THROW_COMPILE_ONLY, func() error {
+			if c.current == nil {
+				return &CompileError{name.Pos, name.Str, "can only be used while compiling", THROW_COMPILE_ONLY}
+			}
+			return handler(c, name)
+		})
+		c.emit(AbstractOp{OP_HOSTCALL, index, VoidDatum{}, name.Pos})
+	} else if c.isImmediate(name) {
+		c.emit(AbstractOp{OP_CALL, 0, StringDatum{name.Str}, name.Pos})
+	} else {
+		// Words in the dictionary get looked up now, so that redefining one later doesn't change what gets compiled.
+		ops, err := c.compileToken(name)
+		if err != nil {
+			return err
+		}
+		key := "compile " + name.Str
+		if !c.isBuiltIn(name.Str) {
+			address, ok := c.vm.Dict[name.Str]
+			if !ok {
+				return c.undefinedWord(ops[0])
+			}
+			ops = []AbstractOp{{OP_CALL, 0, IntegerDatum{int64(address)}, name.Pos}}
+			key = fmt.Sprintf("compile %s at %d", name.Str, address)
+		}
+		index := c.hostCall(key, THROW_COMPILE_ONLY, func() error {
+			if c.current == nil {
+				return &CompileError{name.Pos, name.Str, "can only be used while compiling", THROW_COMPILE_ONLY}
+			}
+			c.emit(ops...)
+			return nil
+		})
+		c.emit(AbstractOp{OP_HOSTCALL, index, VoidDatum{}, name.Pos})
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package forth
+
+import (
+	"errors"
+	"os"
+)
+
+// Input sources can't nest deeper than this, so that a file which includes itself fails instead of eating the stack.
+const MAX_INPUT_DEPTH = 64
+
+// Words which change where the code is coming from. They need the parser, so the compiler turns them into host calls.
+var inputWords map[string]func(*Compiler, Token) error
+
+func init() {
+	inputWords = map[string]func(*Compiler, Token) error{
+		"refill":   refill,
+		"evaluate": evaluate,
+		"include":  include,
+		"included": included,
+	}
+}
+
+// ( -- flag ) Reads the next line of the input source into the input buffer, if there is one.
+func refill(c *Compiler, token Token) error {
+	more, err := c.parser.refill()
+	if err != nil {
+		return err
+	}
+	c.vm.pushFlag(more)
+	return nil
+}
+
+// ( i*x c-addr u -- j*x ) Interprets a string as if it were the input.
+func evaluate(c *Compiler, token Token) error {
+	length, address := c.vm.popInteger(), c.vm.popInteger()
+	c.vm.memory(address, length)
+	return c.interpretNested(func() { c.parser.pushString(address, length) })
+}
+
+// ( i*x "name" -- j*x ) Interprets a file.
+func include(c *Compiler, token Token) error {
+	address, length := c.vm.parseName()
+	if length == 0 {
+		return &CompileError{token.Pos, token.Str, "expected a file name after it", THROW_ZERO_LENGTH_NAME}
+	}
+	return c.includeFile(string(c.vm.memory(address, length)))
+}
+
+// ( i*x c-addr u -- j*x ) Likewise, but the file name comes from the stack.
+func included(c *Compiler, token Token) error {
+	length, address := c.vm.popInteger(), c.vm.popInteger()
+	return c.includeFile(string(c.vm.memory(address, length)))
+}
+
+func (c *Compiler) includeFile(name string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		c.vm.throw(THROW_NONEXISTENT_FILE, "%v", err)
+	}
+	defer file.Close()
+	return c.interpretNested(func() { c.parser.pushReader(file, 0) })
+}
+
+// Interprets a new input source from inside running code, then goes back to the one we were in before. Errors which
+// aren't already throws get turned into one with the error's code, and the whole message so that we can still tell
+// where they happened.
+func (c *Compiler) interpretNested(push func()) error {
+	if len(c.parser.sources) >= MAX_INPUT_DEPTH {
+		c.vm.throw(THROW_RETURN_STACK_OVERFLOW, "input sources are nested too deeply")
+	}
+	push()
+	defer c.parser.pop()
+
+	defining := c.current != nil
+	err := c.interpretSource()
+	if err != nil && !defining {
+		// Don't leave a half-finished definition lying around for whoever catches this.
+		c.endDefinition()
+	}
+	var runtimeError *RuntimeError
+	var bye *Bye
+	var compileError *CompileError
+	var syntaxError *SyntaxError
+	switch {
+	case err == nil, errors.As(err, &runtimeError), errors.As(err, &bye):
+		return err
+	case errors.As(err, &compileError):
+		c.vm.throw(compileError.Code, "%v", err)
+	case errors.As(err, &syntaxError):
+		c.vm.throw(syntaxError.Code, "%v", err)
+	}
+	c.vm.throw(THROW_FILE_IO, "%v", err)
+	return nil
+}
+
+// Returns the host function which runs an input word from inside compiled code.
+func (c *Compiler) inputHostCall(token Token) uint32 {
+	word := inputWords[token.Str]
+	return c.hostCall(token.Str, THROW_INVALID_NAME, func() error { return word(c, token) })
+}
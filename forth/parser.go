@@ -0,0 +1,332 @@
+package forth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Reads tokens from a stack of input sources. The current one lives in the VM's memory along with >in, so that Forth
+// code can parse it too; see the VM's parse methods.
+type Parser struct {
+	vm *VirtualMachine
+	sources []*inputSource // The one being parsed is the last one
+	pushedBackToken *Token
+}
+
+// Somewhere code comes from. Code from a reader gets copied into the input buffer a line at a time, but strings given
+// to 'evaluate' get parsed right where they are. While a nested source is being parsed, this remembers where we'd
+// got to in this one.
+type inputSource struct {
+	reader *bufio.Reader // Nil for evaluated strings
+	name string
+	line int // The number of the line in the input buffer, or of the line before the first one if we haven't read one yet
+	text []byte // A copy of that line, in case a nested source overwrites the input buffer
+	address, length, in int64
+}
+
+// Makes a parser for some code. Parsers keep their input in a VM's memory, so this one gets a VM of its own.
+func NewParser(data io.Reader) *Parser {
+	p := newParser(NewVirtualMachine())
+	p.pushReader(data, 0)
+	return p
+}
+
+func newParser(vm *VirtualMachine) *Parser {
+	return &Parser{vm: vm}
+}
+
+// Files know their own names, which makes for nicer error messages.
+func sourceName(data io.Reader) string {
+	if named, ok := data.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return ""
+}
+
+// Starts parsing code from a reader, whose first line comes after the given line number. It doesn't get read until
+// we need it.
+func (p *Parser) pushReader(data io.Reader, line int) *inputSource {
+	source := &inputSource{reader: bufio.NewReader(data), name: sourceName(data), line: line}
+	p.push(source, INPUT_BUFFER, 0)
+	return source
+}
+
+// Starts parsing a string in the data space.
+func (p *Parser) pushString(address, length int64) {
+	p.push(&inputSource{name: "evaluate", line: 1}, address, length)
+}
+
+func (p *Parser) push(source *inputSource, address, length int64) {
+	if outer := p.current(); outer != nil {
+		outer.address, outer.length = p.vm.source()
+		outer.in = p.vm.fetchCell(TO_IN_ADDRESS)
+	}
+	p.sources = append(p.sources, source)
+	p.setSource(address, length)
+	p.vm.storeCell(TO_IN_ADDRESS, 0)
+}
+
+// Goes back to parsing whatever we were parsing before the current source.
+func (p *Parser) pop() {
+	p.sources = p.sources[:len(p.sources) - 1]
+	p.pushedBackToken = nil
+
+	source := p.current()
+	if source == nil {
+		p.setSource(INPUT_BUFFER, 0)
+		p.vm.storeCell(TO_IN_ADDRESS, 0)
+		return
+	}
+	if source.reader != nil {
+		copy(p.vm.Memory[INPUT_BUFFER:], source.text)
+	}
+	p.setSource(source.address, source.length)
+	p.vm.storeCell(TO_IN_ADDRESS, source.in)
+}
+
+// The source being parsed, or nil if there isn't one.
+func (p *Parser) current() *inputSource {
+	if len(p.sources) == 0 {
+		return nil
+	}
+	return p.sources[len(p.sources) - 1]
+}
+
+func (p *Parser) setSource(address, length int64) {
+	p.vm.storeCell(SOURCE_ADDRESS, address)
+	p.vm.storeCell(SOURCE_ADDRESS + CELL_SIZE, length)
+}
+
+// Reads the next line of the current source into the input buffer. Returns false if there isn't one, which is always
+// the case for evaluated strings.
+func (p *Parser) refill() (bool, error) {
+	source := p.current()
+	if source == nil || source.reader == nil {
+		return false, nil
+	}
+
+	line, err := source.reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return false, nil
+	} else if err != nil && err != io.EOF {
+		return false, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	source.line++
+	if len(line) > INPUT_BUFFER_SIZE {
+		pos := Position{source.name, source.line, 1}
+		return false, &SyntaxError{pos, "", fmt.Sprintf("line is longer than %d bytes", INPUT_BUFFER_SIZE), THROW_PARSED_STRING_OVERFLOW}
+	}
+
+	source.text = []byte(line)
+	copy(p.vm.Memory[INPUT_BUFFER:], source.text)
+	p.setSource(INPUT_BUFFER, int64(len(line)))
+	p.vm.storeCell(TO_IN_ADDRESS, 0)
+	return true, nil
+}
+
+// Where the next character to be parsed came from.
+func (p *Parser) position() Position {
+	source := p.current()
+	if source == nil {
+		return Position{}
+	}
+	line := source.line
+	if line == 0 {
+		line = 1 // We haven't read anything yet, but we'll start at the first line when we do.
+	}
+	return Position{source.name, line, int(p.vm.inputOffset()) + 1}
+}
+
+func (p *Parser) ReadToken() (Token, error) {
+  if p.pushedBackToken != nil {
+		token := p.pushedBackToken
+		p.pushedBackToken = nil
+		return *token, nil
+	}
+	return p.nextToken()
+}
+
+// Reads the next word as the name of something that's being defined. Unlike ReadToken, it never turns it into a
+// number, so that ': add' still works after 'hex'. Returns an EOF_TOKEN if the input runs out first.
+func (p *Parser) ReadName() (Token, error) {
+	if p.pushedBackToken != nil {
+		return p.ReadToken()
+	}
+	if more, err := p.skipSpace(); err != nil || !more {
+		return Token{EOF_TOKEN, 0, "", p.position()}, err
+	}
+	pos := p.position()
+	address, length := p.vm.parseName()
+	return Token{FUNCALL_TOKEN, 0, string(p.vm.Memory[address:address + length]), pos}, nil
+}
+
+func (p *Parser) UnreadToken(t Token) {
+	if p.pushedBackToken != nil {
+		panic(fmt.Sprintf("WTF: Token %v already pushed, but tried to push %v", *p.pushedBackToken, t))
+	}
+	p.pushedBackToken = &t
+}
+
+func (p *Parser) PeekToken() (Token, error) {
+	token, err := p.ReadToken()
+	if err == nil {
+		p.UnreadToken(token)
+	}
+	return token, err
+}
+
+// Reads one character from the current line, or returns false at the end of it.
+func (p *Parser) readChar() (byte, bool) {
+	_, text := p.vm.unparsed()
+	if len(text) == 0 {
+		return 0, false
+	}
+	p.vm.skipInput(1)
+	return text[0], true
+}
+
+// Skips over whitespace, reading more lines if we have to. Returns false if the source runs out first.
+func (p *Parser) skipSpace() (bool, error) {
+	for {
+		p.vm.skipDelimiters(' ')
+		if _, text := p.vm.unparsed(); len(text) > 0 {
+			return true, nil
+		}
+		if more, err := p.refill(); err != nil || !more {
+			return false, err
+		}
+	}
+}
+
+// Skips everything up to and including the next delimiter, even if it's a few lines away. Returns false if the
+// source runs out first.
+func (p *Parser) skipPast(delimiter byte) (bool, error) {
+	for {
+		if _, _, found := p.vm.parse(delimiter); found {
+			return true, nil
+		}
+		if more, err := p.refill(); err != nil || !more {
+			return false, err
+		}
+	}
+}
+
+// Reads characters up to the next double quote, which gets consumed but isn't part of the string. If escaped is
+// true, backslashes work the same way as in ANS Forth's s\" word. The token is only for error messages.
+func (p *Parser) ParseString(token string, escaped bool) (string, error) {
+	var str strings.Builder
+	start := p.position()
+
+	for {
+		r, ok := p.readChar()
+		if !ok {
+			return "", &SyntaxError{start, token, "no closing '\"' for string", THROW_UNEXPECTED_EOF}
+		}
+
+		if r == '"' {
+			return str.String(), nil
+		} else if r == '\\' && escaped {
+			if err := p.readEscape(&str, token); err != nil {
+				return "", err
+			}
+		} else {
+			str.WriteByte(r)
+		}
+	}
+}
+
+var escapes = map[byte]string{
+	'a': "\a", 'b': "\b", 'e': "\x1b", 'f': "\f", 'l': "\n", 'm': "\r\n", 'n': "\n", 'q': "\"", 'r': "\r",
+	't': "\t", 'v': "\v", 'z': "\x00", '"': "\"", '\\': "\\",
+}
+
+// Handles whatever comes after a backslash in an escaped string.
+func (p *Parser) readEscape(str *strings.Builder, token string) error {
+	pos := p.position()
+	r, ok := p.readChar()
+	if !ok {
+		return &SyntaxError{pos, token, "no closing '\"' for string", THROW_UNEXPECTED_EOF}
+	}
+	if escape, ok := escapes[r]; ok {
+		str.WriteString(escape)
+		return nil
+	}
+	if r != 'x' {
+		return &SyntaxError{pos, token, fmt.Sprintf("unknown escape sequence '\\%c'", r), THROW_INVALID_ESCAPE}
+	}
+
+	digits := make([]byte, 2)
+	for i := range digits {
+		if digits[i], ok = p.readChar(); !ok {
+			return &SyntaxError{pos, token, "no closing '\"' for string", THROW_UNEXPECTED_EOF}
+		}
+	}
+	value, err := strconv.ParseUint(string(digits), 16, 8)
+	if err != nil {
+		return &SyntaxError{pos, token, fmt.Sprintf("bad hex escape '\\x%s'", string(digits)), THROW_INVALID_ESCAPE}
+	}
+	str.WriteByte(byte(value))
+	return nil
+}
+
+func (p *Parser) nextToken() (Token, error) {
+	if more, err := p.skipSpace(); err != nil || !more {
+		return Token{EOF_TOKEN, 0, "", p.position()}, err
+	}
+	pos := p.position()
+	if _, text := p.vm.unparsed(); text[0] == '"' {
+		p.vm.skipInput(1)
+		str, err := p.ParseString(`"`, true)
+		return Token{STRING_TOKEN, 0, str, pos}, err
+	}
+
+	address, length := p.vm.parseName()
+	s := string(p.vm.Memory[address:address + length])
+
+	// Words beat numbers, so that a word called 'add' still works after 'hex', and 'i' still works in base 20.
+	key := p.vm.dictKey(s)
+	if _, isWord := p.vm.Dict[key]; !isWord && !isBuiltInKey(key) {
+		if value, ok := parseNumber(s, p.vm.fetchCell(BASE_ADDRESS)); ok {
+			return Token{INTEGER_TOKEN, value, "", pos}, nil
+		}
+	}
+
+	switch key {
+	case ":", ";", "if", "then", "else", "begin", "until", "while", "repeat", "again", "leave", "do", "?do", "loop",
+		"+loop":
+		return Token{KEYWORD_TOKEN, 0, key, pos}, nil
+	default:
+		return Token{FUNCALL_TOKEN, 0, s, pos}, nil
+	}
+}
+
+// Converts a number in the given base, or one of Forth 2012's prefixed numbers: #decimal, $hex, %binary, or 'c' for
+// a character. Numbers which only fit in an unsigned cell wrap around, so $FFFFFFFFFFFFFFFF is -1.
+func parseNumber(s string, base int64) (int64, bool) {
+	if len(s) == 3 && s[0] == '\'' && s[2] == '\'' {
+		return int64(s[1]), true
+	}
+	if len(s) > 1 {
+		switch s[0] {
+		case '#':
+			s, base = s[1:], 10
+		case '$':
+			s, base = s[1:], 16
+		case '%':
+			s, base = s[1:], 2
+		}
+	}
+	if base < 2 || base > 36 {
+		return 0, false
+	}
+
+	if value, err := strconv.ParseInt(s, int(base), 64); err == nil {
+		return value, true
+	}
+	value, err := strconv.ParseUint(s, int(base), 64)
+	return int64(value), err == nil
+}
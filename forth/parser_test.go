@@ -0,0 +1,120 @@
+package forth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func compareTokens(t *testing.T, code string, tokens ...Token) {
+	parser := NewParser(strings.NewReader(code))
+
+	for i := 0 ;; i++ {
+		token, err := parser.ReadToken()
+		if err != nil {
+			t.Fatalf("Unexpected error reading token %d: %v", i, err)
+		}
+		token.Pos = Position{}
+		if i >= len(tokens) {
+			t.Fatalf("Too many tokens! Extra token was %v", token)
+		}
+		if token != tokens[i] {
+			t.Errorf("Expected token %d to be %v, but it was %v", i, tokens[i], token)
+		}
+		if token.TokenType == EOF_TOKEN {
+			if i < len(tokens) - 1 {
+				t.Errorf("Not enough tokens! Next token should have been %v", tokens[i + 1])
+			}
+			break
+		}
+	}
+}
+
+func TestEmptyInput(t *testing.T) {
+	compareTokens(t, "", Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestIntegers(t *testing.T) {
+	compareTokens(t, "1 31337 -7", Token{INTEGER_TOKEN, 1, "", Position{}}, Token{INTEGER_TOKEN, 31337, "", Position{}}, Token{INTEGER_TOKEN, -7, "", Position{}}, Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestPrefixedNumbers(t *testing.T) {
+	compareTokens(t, "#12 $ff %101 'a' $-10 -$10 #", Token{INTEGER_TOKEN, 12, "", Position{}}, Token{INTEGER_TOKEN, 255, "", Position{}}, Token{INTEGER_TOKEN, 5, "", Position{}}, Token{INTEGER_TOKEN, 97, "", Position{}}, Token{INTEGER_TOKEN, -16, "", Position{}}, Token{FUNCALL_TOKEN, 0, "-$10", Position{}}, Token{FUNCALL_TOKEN, 0, "#", Position{}}, Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestStrings(t *testing.T) {
+	compareTokens(t, `"1" "" "\n" "foo"`, Token{STRING_TOKEN, 0, "1", Position{}}, Token{STRING_TOKEN, 0, "", Position{}}, Token{STRING_TOKEN, 0, "\n", Position{}}, Token{STRING_TOKEN, 0, "foo", Position{}}, Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestStringsWithSpacesAndEscapes(t *testing.T) {
+	compareTokens(t, "\"hello world\" \"tab\\there\\\"\" \"\\x41\\\\\"x",
+		Token{STRING_TOKEN, 0, "hello world", Position{}},
+		Token{STRING_TOKEN, 0, "tab\there\"", Position{}},
+		Token{STRING_TOKEN, 0, "A\\", Position{}},
+		Token{FUNCALL_TOKEN, 0, "x", Position{}},
+		Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestParseString(t *testing.T) {
+	parser := NewParser(strings.NewReader(`s" a \n b" rest`))
+	if token, _ := parser.ReadToken(); token.Str != `s"` {
+		t.Fatalf("Expected s\", but got %v", token)
+	}
+	if str, err := parser.ParseString(`s"`, false); err != nil || str != `a \n b` {
+		t.Errorf("Expected the raw string, but got %q (%v)", str, err)
+	}
+	if token, _ := parser.ReadToken(); token.Str != "rest" || token.Pos != (Position{"", 1, 12}) {
+		t.Errorf("Expected the parser to carry on after the string, but got %v", token)
+	}
+}
+
+func TestBadStrings(t *testing.T) {
+	for _, code := range []string{`"abc`, `"\q`, `"\xZZ"`, `"\k"`} {
+		parser := NewParser(strings.NewReader(code))
+		_, err := parser.ReadToken()
+		var syntaxError *SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("Expected a syntax error from %s, but got %v", code, err)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	compareTokens(t, "a A 0= foo? ?bar - ", Token{FUNCALL_TOKEN, 0, "a", Position{}}, Token{FUNCALL_TOKEN, 0, "A", Position{}}, Token{FUNCALL_TOKEN, 0, "0=", Position{}}, Token{FUNCALL_TOKEN, 0, "foo?", Position{}}, Token{FUNCALL_TOKEN, 0, "?bar", Position{}}, Token{FUNCALL_TOKEN, 0, "-", Position{}}, Token{EOF_TOKEN, 0, "", Position{}})
+}
+
+func TestTokenPositions(t *testing.T) {
+	parser := NewParser(strings.NewReader("foo  1\n\t bar"))
+	expected := []Position{{"", 1, 1}, {"", 1, 6}, {"", 2, 3}, {"", 2, 6}}
+
+	for i, pos := range expected {
+		token, err := parser.ReadToken()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if token.Pos != pos {
+			t.Errorf("Expected token %d (%v) to be at %v, but it was at %v", i, token, pos, token.Pos)
+		}
+	}
+}
+
+func TestPeekToken(t *testing.T) {
+	parser := NewParser(strings.NewReader("a b"))
+	a, b := Token{FUNCALL_TOKEN, 0, "a", Position{}}, Token{FUNCALL_TOKEN, 0, "b", Position{}}
+
+	if token, _ := parser.PeekToken(); token.Str != a.Str {
+		t.Errorf("Expected a, got %v", token)
+	}
+	if token, _ := parser.PeekToken(); token.Str != a.Str {
+		t.Errorf("Expected a, got %v", token)
+	}
+	if token, _ := parser.ReadToken(); token.Str != a.Str {
+		t.Errorf("Expected a, got %v", token)
+	}
+	if token, _ := parser.PeekToken(); token.Str != b.Str {
+		t.Errorf("Expected b, got %v", token)
+	}
+	if token, _ := parser.ReadToken(); token.Str != b.Str {
+		t.Errorf("Expected b, got %v", token)
+	}
+}
@@ -0,0 +1,49 @@
+package forth
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Reads code a line at a time and runs each line as soon as it's entered, like a normal Forth system. Errors get
+// reported, but they don't end the session. The VM reads its input from the same place, so 'key' and 'accept' get
+// whatever comes after the current line.
+func runREPL(c *Compiler, in io.Reader, out io.Writer) error {
+	if in != c.vm.Input {
+		savedInput := c.vm.Input
+		c.vm.Input = in
+		defer func() { c.vm.Input = savedInput }()
+	}
+	lines := c.vm.inputReader()
+
+	for {
+		line, err := lines.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+
+		var bye *Bye
+		if err := c.LoadLine(strings.NewReader(line)); errors.As(err, &bye) {
+			return bye
+		} else if err != nil {
+			fmt.Fprintln(out, err)
+		} else if c.current != nil {
+			fmt.Fprintln(out, " compiled")
+		} else if depth := len(c.vm.dataStack); depth > 0 {
+			fmt.Fprintf(out, " ok %d\n", depth)
+		} else {
+			fmt.Fprintln(out, " ok")
+		}
+	}
+}
+
+// A file is interactive if it's a terminal rather than an ordinary file or a pipe.
+func IsInteractive(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode() & os.ModeCharDevice != 0
+}
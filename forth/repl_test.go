@@ -0,0 +1,66 @@
+package forth
+
+import (
+	"os"
+	"strings"
+)
+
+func runSession(input string) {
+	c := NewCompiler(NewVirtualMachine())
+	if err := c.LoadBuiltins(); err != nil {
+		panic(err)
+	}
+	if err := runREPL(c, strings.NewReader(input), os.Stdout); err != nil {
+		panic(err)
+	}
+}
+
+func Example_repl() {
+	runSession("1 2\n+ .\n")
+	// Output:
+	//  ok 2
+	// 3 ok
+}
+
+func Example_repl_multi_line_definition() {
+	runSession(": foo\n  1 2 +\n;\nfoo . cr\n")
+	// Output:
+	//  compiled
+	//  compiled
+	//  ok
+	// 3
+	//  ok
+}
+
+func Example_repl_multi_line_loop() {
+	runSession("3 0 do\ni .\nloop\n")
+	// Output:
+	//  compiled
+	//  compiled
+	// 012 ok
+}
+
+func Example_repl_errors() {
+	runSession(": foo 5 ;\n1 frobnicate\n: bar\n1 then\nfoo . 2 0 /\nfoo .\n")
+	// Output:
+	//  ok
+	// 2:3: can't compile 'frobnicate': undefined word
+	//  compiled
+	// 4:3: can't compile 'then': no matching 'if'
+	// 55:11: in 'top-level code': -10 division by zero
+	// 5 ok 2
+}
+
+func Example_repl_key() {
+	runSession("key . key .\nab\n")
+	// Output:
+	// 9798 ok
+	//  ok
+}
+
+func Example_repl_failed_definition() {
+	runSession(": bad undefined-thing ;\nbad\n")
+	// Output:
+	// 1:7: can't compile 'undefined-thing': undefined word
+	// 2:1: can't compile 'bad': undefined word
+}
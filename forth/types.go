@@ -0,0 +1,351 @@
+package forth
+
+import (
+	"fmt"
+)
+
+const (
+	OP_INVALID uint8 = iota   // 00
+	OP_RETURN                 // 01
+	OP_PUSH                   // 02
+	OP_CALL                   // 03
+	OP_JUMP                   // 04
+	OP_JUMP_IF_NOT            // 05
+	OP_PRINT                  // 06
+	OP_ADD                    // 07
+	OP_MOD                    // 08
+	OP_DUP                    // 09
+	OP_DROP                   // 0a
+	OP_AND                    // 0b
+	OP_STORE                  // 0c
+	OP_FETCH                  // 0d
+	OP_DO                     // 0e
+	OP_QDO                    // 0f
+	OP_LOOP                   // 10
+	OP_PLUS_LOOP              // 11
+	OP_I                      // 12
+	OP_J                      // 13
+	OP_UNLOOP                 // 14
+	OP_SUB                    // 15
+	OP_MUL                    // 16
+	OP_DIV                    // 17
+	OP_DIV_MOD                // 18
+	OP_STAR_SLASH             // 19
+	OP_STAR_SLASH_MOD         // 1a
+	OP_NEGATE                 // 1b
+	OP_ABS                    // 1c
+	OP_MIN                    // 1d
+	OP_MAX                    // 1e
+	OP_OR                     // 1f
+	OP_XOR                    // 20
+	OP_INVERT                 // 21
+	OP_LSHIFT                 // 22
+	OP_RSHIFT                 // 23
+	OP_EQUAL                  // 24
+	OP_NOT_EQUAL              // 25
+	OP_LESS                   // 26
+	OP_GREATER                // 27
+	OP_U_LESS                 // 28
+	OP_U_GREATER              // 29
+	OP_ZERO_EQUAL             // 2a
+	OP_ZERO_NOT_EQUAL         // 2b
+	OP_ZERO_LESS              // 2c
+	OP_ZERO_GREATER           // 2d
+	OP_ONE_PLUS               // 2e
+	OP_ONE_MINUS              // 2f
+	OP_TWO_STAR               // 30
+	OP_TWO_SLASH              // 31
+	OP_WITHIN                 // 32
+	OP_S_TO_D                 // 33
+	OP_M_STAR                 // 34
+	OP_UM_STAR                // 35
+	OP_UM_SLASH_MOD           // 36
+	OP_FM_SLASH_MOD           // 37
+	OP_SM_SLASH_REM           // 38
+	OP_SWAP                   // 39
+	OP_ROT                    // 3a
+	OP_MINUS_ROT              // 3b
+	OP_NIP                    // 3c
+	OP_TUCK                   // 3d
+	OP_PICK                   // 3e
+	OP_ROLL                   // 3f
+	OP_QDUP                   // 40
+	OP_DEPTH                  // 41
+	OP_TWO_SWAP               // 42
+	OP_TWO_OVER               // 43
+	OP_TWO_ROT                // 44
+	OP_TO_R                   // 45
+	OP_R_FROM                 // 46
+	OP_R_FETCH                // 47
+	OP_TWO_TO_R               // 48
+	OP_TWO_R_FROM             // 49
+	OP_TWO_R_FETCH            // 4a
+	OP_TWO_DUP                // 4b
+	OP_HERE                   // 4c
+	OP_ALLOT                  // 4d
+	OP_COMMA                  // 4e
+	OP_C_COMMA                // 4f
+	OP_C_STORE                // 50
+	OP_C_FETCH                // 51
+	OP_PLUS_STORE             // 52
+	OP_CELLS                  // 53
+	OP_CELL_PLUS              // 54
+	OP_CHARS                  // 55
+	OP_ALIGN                  // 56
+	OP_ALIGNED                // 57
+	OP_FILL                   // 58
+	OP_MOVE                   // 59
+	OP_ERASE                  // 5a
+	OP_TWO_STORE              // 5b
+	OP_TWO_FETCH              // 5c
+	OP_HOSTCALL               // 5d
+	OP_DOES                   // 5e
+	OP_TO_BODY                // 5f
+	OP_EXECUTE                // 60
+	OP_BYE                    // 61
+	OP_TYPE                   // 62
+	OP_COUNT                  // 63
+	OP_SOURCE                 // 64
+	OP_PARSE                  // 65
+	OP_PARSE_NAME             // 66
+	OP_WORD                   // 67
+	OP_U_PRINT                // 68
+	OP_PRINT_R                // 69
+	OP_U_PRINT_R              // 6a
+	OP_TO_NUMBER              // 6b
+	OP_LESS_NUMBER_SIGN       // 6c
+	OP_NUMBER_SIGN            // 6d
+	OP_NUMBER_SIGN_S          // 6e
+	OP_HOLD                   // 6f
+	OP_HOLDS                  // 70
+	OP_SIGN                   // 71
+	OP_NUMBER_SIGN_GREATER    // 72
+	OP_EMIT                   // 73
+	OP_SPACES                 // 74
+	OP_KEY                    // 75
+	OP_KEY_QUESTION           // 76
+	OP_ACCEPT                 // 77
+	OP_CATCH                  // 78
+	OP_THROW                  // 79
+	OP_ABORT_QUOTE            // 7a
+	OP_TAIL_CALL              // 7b
+)
+
+var OpNames = []string{
+	"INVALID",
+	"RETURN",
+	"PUSH",
+	"CALL",
+	"JUMP",
+	"JUMP_IF_NOT",
+	"PRINT",
+	"ADD",
+	"MOD",
+	"DUP",
+	"DROP",
+	"AND",
+	"STORE",
+	"FETCH",
+	"DO",
+	"QDO",
+	"LOOP",
+	"PLUS_LOOP",
+	"I",
+	"J",
+	"UNLOOP",
+	"SUB",
+	"MUL",
+	"DIV",
+	"DIV_MOD",
+	"STAR_SLASH",
+	"STAR_SLASH_MOD",
+	"NEGATE",
+	"ABS",
+	"MIN",
+	"MAX",
+	"OR",
+	"XOR",
+	"INVERT",
+	"LSHIFT",
+	"RSHIFT",
+	"EQUAL",
+	"NOT_EQUAL",
+	"LESS",
+	"GREATER",
+	"U_LESS",
+	"U_GREATER",
+	"ZERO_EQUAL",
+	"ZERO_NOT_EQUAL",
+	"ZERO_LESS",
+	"ZERO_GREATER",
+	"ONE_PLUS",
+	"ONE_MINUS",
+	"TWO_STAR",
+	"TWO_SLASH",
+	"WITHIN",
+	"S_TO_D",
+	"M_STAR",
+	"UM_STAR",
+	"UM_SLASH_MOD",
+	"FM_SLASH_MOD",
+	"SM_SLASH_REM",
+	"SWAP",
+	"ROT",
+	"MINUS_ROT",
+	"NIP",
+	"TUCK",
+	"PICK",
+	"ROLL",
+	"QDUP",
+	"DEPTH",
+	"TWO_SWAP",
+	"TWO_OVER",
+	"TWO_ROT",
+	"TO_R",
+	"R_FROM",
+	"R_FETCH",
+	"TWO_TO_R",
+	"TWO_R_FROM",
+	"TWO_R_FETCH",
+	"TWO_DUP",
+	"HERE",
+	"ALLOT",
+	"COMMA",
+	"C_COMMA",
+	"C_STORE",
+	"C_FETCH",
+	"PLUS_STORE",
+	"CELLS",
+	"CELL_PLUS",
+	"CHARS",
+	"ALIGN",
+	"ALIGNED",
+	"FILL",
+	"MOVE",
+	"ERASE",
+	"TWO_STORE",
+	"TWO_FETCH",
+	"HOSTCALL",
+	"DOES",
+	"TO_BODY",
+	"EXECUTE",
+	"BYE",
+	"TYPE",
+	"COUNT",
+	"SOURCE",
+	"PARSE",
+	"PARSE_NAME",
+	"WORD",
+	"U_PRINT",
+	"PRINT_R",
+	"U_PRINT_R",
+	"TO_NUMBER",
+	"LESS_NUMBER_SIGN",
+	"NUMBER_SIGN",
+	"NUMBER_SIGN_S",
+	"HOLD",
+	"HOLDS",
+	"SIGN",
+	"NUMBER_SIGN_GREATER",
+	"EMIT",
+	"SPACES",
+	"KEY",
+	"KEY_QUESTION",
+	"ACCEPT",
+	"CATCH",
+	"THROW",
+	"ABORT_QUOTE",
+	"TAIL_CALL",
+}
+
+const (
+  TYPE_VOID uint8 = iota
+	TYPE_INTEGER
+	TYPE_STRING
+)
+
+var TypeNames = []string{
+	"void",
+	"integer",
+	"string",
+}
+
+const (
+	INTEGER_TOKEN uint8 = iota
+	STRING_TOKEN
+	KEYWORD_TOKEN
+	FUNCALL_TOKEN
+	EOF_TOKEN
+)
+
+// Where something came from in the source code.
+type Position struct {
+	File string
+	Line int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// What goes in front of an error message. Words which come from Go code, like the ones Forth.Call runs, have no
+// position, so their errors don't get one.
+func (p Position) prefix() string {
+	if p == (Position{}) {
+		return ""
+	}
+	return p.String() + ": "
+}
+
+// Too simple to be worth using an interface for.
+type Token struct {
+  TokenType uint8
+	Int int64
+	Str string
+	Pos Position
+}
+
+type Datum interface {
+	DataType() uint8
+}
+
+type IntegerDatum struct {
+	Int int64
+}
+
+type VoidDatum struct {}
+
+type StringDatum struct {
+	Str string
+}
+
+func (i VoidDatum) DataType() uint8 {
+	return TYPE_VOID
+}
+
+func (i IntegerDatum) DataType() uint8 {
+	return TYPE_INTEGER
+}
+
+func (i StringDatum) DataType() uint8 {
+	return TYPE_STRING
+}
+
+type AbstractOp struct {
+	Opcode uint8
+	Arg uint32
+	Datum Datum
+	Pos Position
+}
+
+type PackedOp uint32
+
+type Word struct {
+	Name string
+	Ops []AbstractOp
+	Pos Position
+}
@@ -0,0 +1,1141 @@
+package forth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_DATA_STACK_DEPTH = 1024
+	DEFAULT_RETURN_STACK_DEPTH = 1024
+	DEFAULT_MEMORY_SIZE = 1024 * 1024
+	CELL_SIZE = 8
+)
+
+// The start of the data space is reserved for variables which the system itself uses. Address 0 is never valid.
+// Interpreted strings go in one of two buffers, so that the last two strings are always still around.
+const (
+	TRANSIENT_BUFFER_SIZE = 1024
+	INPUT_BUFFER_SIZE = 4096
+	WORD_BUFFER_SIZE = 256
+	PICTURED_BUFFER_SIZE = 256 // Enough for a double-cell number in binary, plus a bit
+)
+
+// What a word made by 'defer' executes until 'is' tells it otherwise. It's not a valid execution token.
+const UNSET_DEFER = -1
+
+// What 'spaces' writes, as many times as it takes.
+var blanks = bytes.Repeat([]byte{' '}, 64)
+
+// What 'key' returns when there's nothing left to read. It isn't a character, so programs can tell.
+const END_OF_INPUT = -1
+
+const (
+	STATE_ADDRESS = CELL_SIZE
+	BASE_ADDRESS = STATE_ADDRESS + CELL_SIZE // The radix for reading and printing numbers
+	TO_IN_ADDRESS = BASE_ADDRESS + CELL_SIZE // How far into the input source we've parsed
+	SOURCE_ADDRESS = TO_IN_ADDRESS + CELL_SIZE // The address and length of the input source, in two cells
+	INPUT_BUFFER = SOURCE_ADDRESS + 2 * CELL_SIZE // Lines from files and the terminal get parsed from here
+	WORD_BUFFER = INPUT_BUFFER + INPUT_BUFFER_SIZE // Where 'word' puts the counted strings it parses
+	PICTURED_BUFFER = WORD_BUFFER + WORD_BUFFER_SIZE // Where <# ... #> builds numbers, from the end backwards
+	TRANSIENT_BUFFERS = PICTURED_BUFFER + PICTURED_BUFFER_SIZE // Where s" puts strings when it's interpreted; see TRANSIENT_BUFFER_SIZE
+	DATA_SPACE_START = TRANSIENT_BUFFERS + 2 * TRANSIENT_BUFFER_SIZE
+)
+
+type VirtualMachine struct {
+	Heap []Datum
+	Dict map[string]uint32
+	Code []PackedOp
+	Ip uint32
+
+	// The data space, addressed in bytes. HERE is always the end of it. It starts with a few reserved cells; see
+	// DATA_SPACE_START.
+	Memory []byte
+
+	// Going deeper or bigger than these will throw an overflow error.
+	MaxDataStackDepth int
+	MaxReturnStackDepth int
+	MaxMemorySize int
+
+	// Where the program's output goes and its input comes from. They're stdout and stdin unless you say otherwise.
+	Output io.Writer
+	Input io.Reader
+
+	// Word names are case-insensitive unless this is set. Change it before defining any words, or they'll get lost.
+	CaseSensitive bool
+
+	dataStack []Datum
+	returnStack []Datum // Return addresses, loop parameters, and anything else the program wants to stash there
+	returnBase int // Execute can be re-entered; words can't return or pop past where the current execution started
+	positions []Position // The source position of each instruction in Code
+	names map[uint32]string // The name of the word which starts at each address in Code
+	latest uint32 // The address of the most recently defined word
+	bodies map[uint32]int64 // The data space address of each word made by 'create', keyed by its code address
+	hostFunctions []func() // Go code which the program can call with OP_HOSTCALL
+	pictured int64 // The address of the last character that pictured numeric output held
+	input *bufio.Reader // Input, buffered so that we can read it a character at a time
+	inputFrom io.Reader // What input is buffering, so that we notice if someone changes Input
+	catchDepth int // How many 'catch'es we're inside, so that 'abort' knows whether anyone will catch it
+}
+
+func NewVirtualMachine() *VirtualMachine {
+	var vm VirtualMachine
+	vm.Dict = make(map[string]uint32)
+	vm.names = make(map[uint32]string)
+	vm.bodies = make(map[uint32]int64)
+	vm.Memory = make([]byte, DATA_SPACE_START)
+	vm.storeCell(BASE_ADDRESS, 10)
+	vm.pictured = PICTURED_BUFFER + PICTURED_BUFFER_SIZE
+	vm.MaxDataStackDepth = DEFAULT_DATA_STACK_DEPTH
+	vm.MaxReturnStackDepth = DEFAULT_RETURN_STACK_DEPTH
+	vm.MaxMemorySize = DEFAULT_MEMORY_SIZE
+	vm.Output = os.Stdout
+	vm.Input = os.Stdin
+	return &vm
+}
+
+// Runs the code at the given address until it returns. The VM's state is left as it is afterwards, so that the next
+// call can pick up where this one left off.
+func (vm *VirtualMachine) Execute(address uint32) (err error) {
+	savedIp, savedBase := vm.Ip, vm.returnBase
+	defer func() { vm.Ip, vm.returnBase = savedIp, savedBase }()
+	vm.Ip = address
+	vm.returnBase = len(vm.returnStack)
+
+	// 'bye' unwinds all the way out to whoever's running the VM.
+	defer func() {
+		if r := recover(); r != nil {
+			bye, ok := r.(*Bye)
+			if !ok {
+				panic(r)
+			}
+			vm.returnStack = vm.returnStack[:vm.returnBase]
+			err = bye
+		}
+	}()
+
+	runtimeError := vm.guard(vm.run)
+	if runtimeError != nil {
+		// Errors from a nested Execute (in code that 'evaluate' ran, say) already know where they happened.
+		if runtimeError.Word == "" {
+			runtimeError.Pos = vm.positionOf(vm.Ip)
+			runtimeError.Word = vm.wordAt(vm.Ip)
+		}
+		vm.returnStack = vm.returnStack[:vm.returnBase]
+		return runtimeError
+	}
+	return nil
+}
+
+// Returns the key that a word's name goes under in Dict.
+func (vm *VirtualMachine) dictKey(name string) string {
+	if vm.CaseSensitive {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
+// Calls f and catches anything it throws.
+func (vm *VirtualMachine) guard(f func()) (err *RuntimeError) {
+	defer func() {
+		if r := recover(); r != nil {
+			runtimeError, ok := r.(*RuntimeError)
+			if !ok {
+				panic(r)
+			}
+			err = runtimeError
+		}
+	}()
+
+	f()
+	return nil
+}
+
+func (vm *VirtualMachine) run() {
+	// vm.printDisassembly()
+
+	for {
+		if int(vm.Ip) >= len(vm.Code) {
+			vm.throw(THROW_INVALID_ADDRESS, "instruction pointer out of bounds")
+		}
+		instruction := vm.Code[vm.Ip]
+		opcode := uint8(instruction & 0xFF)
+		arg := uint32(instruction >> 8)
+		// fmt.Printf("Executing: [%d] opcode %d, arg %d\n", vm.Ip, opcode, arg)
+
+		switch opcode {
+		case OP_PRINT:
+			vm.printDatum(vm.popDataStack(), false)
+		case OP_U_PRINT:
+			fmt.Fprint(vm.Output, vm.formatUnsigned(uint64(vm.popInteger())))
+		case OP_PRINT_R:
+			width, n := vm.popInteger(), vm.popInteger()
+			vm.printRightAligned(vm.formatInteger(n), width)
+		case OP_U_PRINT_R:
+			width, u := vm.popInteger(), vm.popInteger()
+			vm.printRightAligned(vm.formatUnsigned(uint64(u)), width)
+		case OP_LESS_NUMBER_SIGN:
+			vm.pictured = PICTURED_BUFFER + PICTURED_BUFFER_SIZE
+		case OP_NUMBER_SIGN:
+			vm.pushDouble(vm.holdDigit(vm.popDouble()))
+		case OP_NUMBER_SIGN_S:
+			lo, hi := vm.holdDigit(vm.popDouble())
+			for lo != 0 || hi != 0 {
+				lo, hi = vm.holdDigit(lo, hi)
+			}
+			vm.pushDouble(0, 0)
+		case OP_HOLD:
+			vm.hold(byte(vm.popInteger()))
+		case OP_HOLDS:
+			length, address := vm.popInteger(), vm.popInteger()
+			text := vm.memory(address, length)
+			for i := len(text) - 1; i >= 0; i-- {
+				vm.hold(text[i])
+			}
+		case OP_SIGN:
+			if vm.popInteger() < 0 {
+				vm.hold('-')
+			}
+		case OP_NUMBER_SIGN_GREATER:
+			vm.popDouble()
+			vm.pushInteger(vm.pictured)
+			vm.pushInteger(PICTURED_BUFFER + PICTURED_BUFFER_SIZE - vm.pictured)
+		case OP_TO_NUMBER:
+			length, address := vm.popInteger(), vm.popInteger()
+			lo, hi := vm.popDouble()
+			base := uint64(vm.base())
+			text := vm.memory(address, length)
+			n := 0
+			for ; n < len(text); n++ {
+				digit, ok := digitValue(text[n], base)
+				if !ok {
+					break
+				}
+				overflow, product := bits.Mul64(lo, base)
+				sum, carry := bits.Add64(product, digit, 0)
+				lo, hi = sum, hi * base + overflow + carry
+			}
+			vm.pushDouble(lo, hi)
+			vm.pushInteger(address + int64(n))
+			vm.pushInteger(length - int64(n))
+		case OP_TYPE:
+			length, address := vm.popInteger(), vm.popInteger()
+			vm.Output.Write(vm.memory(address, length))
+		case OP_EMIT:
+			char := byte(arg)
+			if arg == 0 {
+				char = byte(vm.popInteger())
+			}
+			vm.Output.Write([]byte{char})
+		case OP_SPACES:
+			vm.writeSpaces(vm.popInteger())
+		case OP_KEY:
+			char, err := vm.inputReader().ReadByte()
+			if err != nil {
+				vm.pushInteger(END_OF_INPUT)
+			} else {
+				vm.pushInteger(int64(char))
+			}
+		case OP_KEY_QUESTION:
+			vm.pushFlag(vm.keyAvailable())
+		case OP_ACCEPT:
+			size, address := vm.popInteger(), vm.popInteger()
+			buffer := vm.memory(address, size)
+			line, _ := vm.inputReader().ReadString('\n')
+			line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+			vm.pushInteger(int64(copy(buffer, line)))
+		case OP_COUNT:
+			address := vm.popInteger()
+			vm.pushInteger(address + 1)
+			vm.pushInteger(int64(vm.memory(address, 1)[0]))
+		case OP_SOURCE:
+			address, length := vm.source()
+			vm.pushInteger(address)
+			vm.pushInteger(length)
+		case OP_PARSE:
+			address, length, _ := vm.parse(byte(vm.popInteger()))
+			vm.pushInteger(address)
+			vm.pushInteger(length)
+		case OP_PARSE_NAME:
+			address, length := vm.parseName()
+			vm.pushInteger(address)
+			vm.pushInteger(length)
+		case OP_WORD:
+			delimiter := byte(vm.popInteger())
+			vm.skipDelimiters(delimiter)
+			address, length, _ := vm.parse(delimiter)
+			if length >= WORD_BUFFER_SIZE {
+				vm.throw(THROW_PARSED_STRING_OVERFLOW, "'word' can't parse more than %d characters", WORD_BUFFER_SIZE - 1)
+			}
+			vm.Memory[WORD_BUFFER] = byte(length)
+			copy(vm.Memory[WORD_BUFFER + 1:], vm.memory(address, length))
+			vm.pushInteger(WORD_BUFFER)
+		case OP_ADD:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushDataStack(IntegerDatum{n1 + n2})
+		case OP_SUB:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(n1 - n2)
+		case OP_MUL:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(n1 * n2)
+		case OP_DIV:
+			divisor, number := vm.popDivisor(), vm.popInteger()
+			vm.pushInteger(number / divisor)
+		case OP_MOD:
+			mod_by, number := vm.popDivisor(), vm.popInteger()
+			vm.pushInteger(number % mod_by)
+		case OP_DIV_MOD:
+			divisor, number := vm.popDivisor(), vm.popInteger()
+			vm.pushInteger(number % divisor)
+			vm.pushInteger(number / divisor)
+		case OP_STAR_SLASH, OP_STAR_SLASH_MOD:
+			divisor, n2, n1 := vm.popDivisor(), vm.popInteger(), vm.popInteger()
+			lo, hi := multiplySigned(n1, n2)
+			remainder, quotient := vm.divideDouble(divideSymmetric, lo, hi, divisor)
+			if opcode == OP_STAR_SLASH_MOD {
+				vm.pushInteger(remainder)
+			}
+			vm.pushInteger(quotient)
+		case OP_NEGATE:
+			vm.pushInteger(-vm.popInteger())
+		case OP_ABS:
+			n := vm.popInteger()
+			if n < 0 {
+				n = -n
+			}
+			vm.pushInteger(n)
+		case OP_MIN, OP_MAX:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			if (n2 < n1) == (opcode == OP_MIN) {
+				n1 = n2
+			}
+			vm.pushInteger(n1)
+		case OP_OR:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(n1 | n2)
+		case OP_XOR:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(n1 ^ n2)
+		case OP_INVERT:
+			vm.pushInteger(^vm.popInteger())
+		case OP_LSHIFT:
+			shift, n := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(int64(uint64(n) << uint64(shift)))
+		case OP_RSHIFT:
+			shift, n := vm.popInteger(), vm.popInteger()
+			vm.pushInteger(int64(uint64(n) >> uint64(shift)))
+		case OP_EQUAL:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(n1 == n2)
+		case OP_NOT_EQUAL:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(n1 != n2)
+		case OP_LESS:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(n1 < n2)
+		case OP_GREATER:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(n1 > n2)
+		case OP_U_LESS:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(uint64(n1) < uint64(n2))
+		case OP_U_GREATER:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushFlag(uint64(n1) > uint64(n2))
+		case OP_ZERO_EQUAL:
+			vm.pushFlag(vm.popInteger() == 0)
+		case OP_ZERO_NOT_EQUAL:
+			vm.pushFlag(vm.popInteger() != 0)
+		case OP_ZERO_LESS:
+			vm.pushFlag(vm.popInteger() < 0)
+		case OP_ZERO_GREATER:
+			vm.pushFlag(vm.popInteger() > 0)
+		case OP_ONE_PLUS:
+			vm.pushInteger(vm.popInteger() + 1)
+		case OP_ONE_MINUS:
+			vm.pushInteger(vm.popInteger() - 1)
+		case OP_TWO_STAR:
+			vm.pushInteger(vm.popInteger() << 1)
+		case OP_TWO_SLASH:
+			vm.pushInteger(vm.popInteger() >> 1)
+		case OP_WITHIN:
+			high, low, n := vm.popInteger(), vm.popInteger(), vm.popInteger()
+			vm.pushFlag(uint64(n - low) < uint64(high - low))
+		case OP_S_TO_D:
+			n := vm.popInteger()
+			vm.pushInteger(n)
+			vm.pushInteger(n >> 63)
+		case OP_M_STAR:
+			n2, n1 := vm.popInteger(), vm.popInteger()
+			vm.pushDouble(multiplySigned(n1, n2))
+		case OP_UM_STAR:
+			u2, u1 := vm.popInteger(), vm.popInteger()
+			hi, lo := bits.Mul64(uint64(u1), uint64(u2))
+			vm.pushDouble(lo, hi)
+		case OP_UM_SLASH_MOD:
+			divisor := uint64(vm.popDivisor())
+			lo, hi := vm.popDouble()
+			if hi >= divisor {
+				vm.throw(THROW_OUT_OF_RANGE, "result out of range")
+			}
+			quotient, remainder := bits.Div64(hi, lo, divisor)
+			vm.pushInteger(int64(remainder))
+			vm.pushInteger(int64(quotient))
+		case OP_FM_SLASH_MOD, OP_SM_SLASH_REM:
+			divisor := vm.popDivisor()
+			lo, hi := vm.popDouble()
+			divide := divideSymmetric
+			if opcode == OP_FM_SLASH_MOD {
+				divide = divideFloored
+			}
+			remainder, quotient := vm.divideDouble(divide, lo, hi, divisor)
+			vm.pushInteger(remainder)
+			vm.pushInteger(quotient)
+		case OP_AND:
+			and_with, number := vm.popInteger(), vm.popInteger()
+			vm.pushDataStack(IntegerDatum{number & and_with})
+		case OP_CALL, OP_TAIL_CALL:
+			if int(arg) >= len(vm.Code) {
+				vm.throw(THROW_UNDEFINED_WORD, "undefined word")
+			}
+			// A tail call is just a jump, so the word it goes to returns straight to our caller.
+			if opcode == OP_CALL {
+				vm.pushReturnStack(IntegerDatum{int64(vm.Ip)})
+			}
+			vm.Ip = arg - 1
+		case OP_RETURN:
+			if len(vm.returnStack) <= vm.returnBase {
+				return
+			}
+			vm.Ip = uint32(vm.popReturnInteger())
+		case OP_PUSH:
+			vm.pushDataStack(vm.Heap[arg])
+		case OP_DUP:
+			vm.requireDepth(int(arg) + 1)
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - int(arg) - 1])
+		case OP_DROP:
+			vm.requireDepth(int(arg))
+			vm.dataStack = vm.dataStack[:len(vm.dataStack) - int(arg)]
+		case OP_TWO_DUP:
+			vm.requireDepth(2)
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - 2])
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - 2])
+		case OP_SWAP:
+			vm.requireDepth(2)
+			stack := vm.dataStack[len(vm.dataStack) - 2:]
+			stack[0], stack[1] = stack[1], stack[0]
+		case OP_ROT:
+			vm.requireDepth(3)
+			stack := vm.dataStack[len(vm.dataStack) - 3:]
+			stack[0], stack[1], stack[2] = stack[1], stack[2], stack[0]
+		case OP_MINUS_ROT:
+			vm.requireDepth(3)
+			stack := vm.dataStack[len(vm.dataStack) - 3:]
+			stack[0], stack[1], stack[2] = stack[2], stack[0], stack[1]
+		case OP_NIP:
+			vm.requireDepth(2)
+			top := vm.popDataStack()
+			vm.dataStack[len(vm.dataStack) - 1] = top
+		case OP_TUCK:
+			vm.requireDepth(2)
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - 1])
+			stack := vm.dataStack[len(vm.dataStack) - 3:]
+			stack[0], stack[1] = stack[1], stack[0]
+		case OP_PICK:
+			depth := vm.popDepth()
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - depth - 1])
+		case OP_ROLL:
+			depth := vm.popDepth()
+			stack := vm.dataStack[len(vm.dataStack) - depth - 1:]
+			rolled := stack[0]
+			copy(stack, stack[1:])
+			stack[depth] = rolled
+		case OP_QDUP:
+			vm.requireDepth(1)
+			top := vm.dataStack[len(vm.dataStack) - 1]
+			if top.DataType() != TYPE_INTEGER || top.(IntegerDatum).Int != 0 {
+				vm.pushDataStack(top)
+			}
+		case OP_DEPTH:
+			vm.pushInteger(int64(len(vm.dataStack)))
+		case OP_TWO_SWAP:
+			vm.requireDepth(4)
+			stack := vm.dataStack[len(vm.dataStack) - 4:]
+			stack[0], stack[1], stack[2], stack[3] = stack[2], stack[3], stack[0], stack[1]
+		case OP_TWO_OVER:
+			vm.requireDepth(4)
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - 4])
+			vm.pushDataStack(vm.dataStack[len(vm.dataStack) - 4])
+		case OP_TWO_ROT:
+			vm.requireDepth(6)
+			stack := vm.dataStack[len(vm.dataStack) - 6:]
+			x1, x2 := stack[0], stack[1]
+			copy(stack, stack[2:])
+			stack[4], stack[5] = x1, x2
+		case OP_TO_R:
+			vm.pushReturnStack(vm.popDataStack())
+		case OP_R_FROM:
+			vm.pushDataStack(vm.popReturnStack())
+		case OP_R_FETCH:
+			vm.pushDataStack(vm.peekReturnStack(0))
+		case OP_TWO_TO_R:
+			x2, x1 := vm.popDataStack(), vm.popDataStack()
+			vm.pushReturnStack(x1)
+			vm.pushReturnStack(x2)
+		case OP_TWO_R_FROM:
+			x2, x1 := vm.popReturnStack(), vm.popReturnStack()
+			vm.pushDataStack(x1)
+			vm.pushDataStack(x2)
+		case OP_TWO_R_FETCH:
+			vm.pushDataStack(vm.peekReturnStack(1))
+			vm.pushDataStack(vm.peekReturnStack(0))
+		case OP_JUMP:
+			vm.Ip = arg - 1
+		case OP_JUMP_IF_NOT:
+			value := vm.popDataStack()
+			if value.DataType() == TYPE_INTEGER && value.(IntegerDatum).Int == 0 {
+				vm.Ip = arg - 1
+			}
+		case OP_DO:
+			index, limit := vm.popInteger(), vm.popInteger()
+			vm.pushReturnStack(IntegerDatum{limit})
+			vm.pushReturnStack(IntegerDatum{index})
+		case OP_QDO:
+			index, limit := vm.popInteger(), vm.popInteger()
+			if index == limit {
+				vm.Ip = arg - 1
+			} else {
+				vm.pushReturnStack(IntegerDatum{limit})
+				vm.pushReturnStack(IntegerDatum{index})
+			}
+		case OP_LOOP:
+			if vm.incrementLoop(1) {
+				vm.Ip = arg - 1
+			}
+		case OP_PLUS_LOOP:
+			if vm.incrementLoop(vm.popInteger()) {
+				vm.Ip = arg - 1
+			}
+		case OP_I:
+			vm.pushDataStack(vm.peekReturnStack(0))
+		case OP_J:
+			vm.pushDataStack(vm.peekReturnStack(2))
+		case OP_UNLOOP:
+			vm.popReturnStack()
+			vm.popReturnStack()
+		case OP_HERE:
+			vm.pushInteger(vm.here())
+		case OP_ALLOT:
+			vm.allot(vm.popInteger())
+		case OP_COMMA:
+			address := vm.here()
+			vm.allot(CELL_SIZE)
+			vm.storeCell(address, vm.popInteger())
+		case OP_C_COMMA:
+			address := vm.here()
+			vm.allot(1)
+			vm.memory(address, 1)[0] = byte(vm.popInteger())
+		case OP_STORE:
+			address, value := vm.popInteger(), vm.popInteger()
+			vm.storeCell(address, value)
+		case OP_FETCH:
+			vm.pushInteger(vm.fetchCell(vm.popInteger()))
+		case OP_EXECUTE:
+			xt := vm.popExecutionToken()
+			vm.pushReturnStack(IntegerDatum{int64(vm.Ip)})
+			vm.Ip = xt - 1
+		case OP_BYE:
+			code := int64(0)
+			if arg != 0 {
+				code = vm.popInteger()
+			}
+			panic(&Bye{int(code)})
+		case OP_CATCH:
+			vm.pushInteger(int64(vm.catch(vm.popExecutionToken())))
+		case OP_THROW:
+			// 'abort' has its code in the instruction, negated to fit; 'throw' takes it off the stack.
+			code := -int(arg)
+			if arg == 0 {
+				code = int(vm.popInteger())
+			}
+			if code != 0 {
+				vm.throwFromProgram(code, "%s", throwMessage(code))
+			}
+		case OP_ABORT_QUOTE:
+			msg := vm.popDataStack().(StringDatum).Str
+			if vm.popInteger() != 0 {
+				vm.throwFromProgram(THROW_ABORT_QUOTE, "%s", msg)
+			}
+		case OP_HOSTCALL:
+			vm.hostFunctions[arg]()
+		case OP_DOES:
+			if _, ok := vm.bodies[vm.latest]; !ok {
+				vm.throw(THROW_NOT_CREATED, "'does>' can only change a word made by 'create'")
+			}
+			// Created words are a PUSH followed by a RETURN, which we turn into a jump to the code after does>.
+			vm.Code[vm.latest + 1] = PackedOp(uint32(OP_JUMP) | (arg << 8))
+		case OP_TO_BODY:
+			address := vm.popInteger()
+			body, ok := vm.bodies[uint32(address)]
+			if !ok || address < 0 {
+				vm.throw(THROW_NOT_CREATED, "'>body' can only be used on a word made by 'create'")
+			}
+			vm.pushInteger(body)
+		case OP_TWO_STORE:
+			address, x2, x1 := vm.popInteger(), vm.popInteger(), vm.popInteger()
+			vm.storeCell(address + CELL_SIZE, x1)
+			vm.storeCell(address, x2)
+		case OP_TWO_FETCH:
+			address := vm.popInteger()
+			vm.pushInteger(vm.fetchCell(address + CELL_SIZE))
+			vm.pushInteger(vm.fetchCell(address))
+		case OP_C_STORE:
+			address, value := vm.popInteger(), vm.popInteger()
+			vm.memory(address, 1)[0] = byte(value)
+		case OP_C_FETCH:
+			vm.pushInteger(int64(vm.memory(vm.popInteger(), 1)[0]))
+		case OP_PLUS_STORE:
+			address, n := vm.popInteger(), vm.popInteger()
+			vm.storeCell(address, vm.fetchCell(address) + n)
+		case OP_CELLS:
+			vm.pushInteger(vm.popInteger() * CELL_SIZE)
+		case OP_CELL_PLUS:
+			vm.pushInteger(vm.popInteger() + CELL_SIZE)
+		case OP_CHARS:
+			vm.pushInteger(vm.popInteger()) // Characters are one byte, but we still want the type check.
+		case OP_ALIGN:
+			vm.allot(aligned(vm.here()) - vm.here())
+		case OP_ALIGNED:
+			vm.pushInteger(aligned(vm.popInteger()))
+		case OP_FILL:
+			char, length, address := vm.popInteger(), vm.popInteger(), vm.popInteger()
+			for i := range vm.memory(address, length) {
+				vm.Memory[address + int64(i)] = byte(char)
+			}
+		case OP_ERASE:
+			length, address := vm.popInteger(), vm.popInteger()
+			for i := range vm.memory(address, length) {
+				vm.Memory[address + int64(i)] = 0
+			}
+		case OP_MOVE:
+			length, to, from := vm.popInteger(), vm.popInteger(), vm.popInteger()
+			copy(vm.memory(to, length), vm.memory(from, length))
+		}
+
+		vm.Ip++
+	}
+}
+
+// Aborts execution of the current program with one of the standard THROW codes. Execute catches this and turns it into
+// a proper error.
+func (vm *VirtualMachine) throw(code int, format string, args ...interface{}) {
+	panic(&RuntimeError{Code: code, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Throws on the program's behalf. If nothing will catch it, 'abort' and 'abort"' empty the data stack first.
+func (vm *VirtualMachine) throwFromProgram(code int, format string, args ...interface{}) {
+	if vm.catchDepth == 0 && (code == THROW_ABORT || code == THROW_ABORT_QUOTE) {
+		vm.dataStack = vm.dataStack[:0]
+	}
+	vm.throw(code, format, args...)
+}
+
+// Runs an execution token and returns the code of whatever it throws, or 0 if it doesn't. If it throws, the stack
+// depths and the input source go back to how they were when it started. 'bye' isn't an exception, so that gets
+// through.
+func (vm *VirtualMachine) catch(xt uint32) int {
+	depth := len(vm.dataStack)
+	sourceAddress, sourceLength := vm.source()
+	in := vm.fetchCell(TO_IN_ADDRESS)
+
+	// The exception frame goes on the return stack like ANS says, so that catches nested too deeply overflow it
+	// instead of Go's own stack.
+	vm.pushReturnStack(IntegerDatum{int64(depth)})
+	vm.catchDepth++
+	err := vm.Execute(xt)
+	vm.catchDepth--
+	vm.returnStack = vm.returnStack[:len(vm.returnStack) - 1]
+	if err == nil {
+		return 0
+	}
+	runtimeError, ok := err.(*RuntimeError)
+	if !ok {
+		panic(err)
+	}
+
+	// Anything past the old top of the stack is garbage now, but it has to be there.
+	for len(vm.dataStack) < depth {
+		vm.dataStack = append(vm.dataStack, IntegerDatum{0})
+	}
+	vm.dataStack = vm.dataStack[:depth]
+	vm.storeCell(SOURCE_ADDRESS, sourceAddress)
+	vm.storeCell(SOURCE_ADDRESS + CELL_SIZE, sourceLength)
+	vm.storeCell(TO_IN_ADDRESS, in)
+	return runtimeError.Code
+}
+
+func (vm *VirtualMachine) popExecutionToken() uint32 {
+	xt := vm.popInteger()
+	if xt < 0 || xt >= int64(len(vm.Code)) {
+		vm.throw(THROW_INVALID_ADDRESS, "invalid execution token %d", xt)
+	}
+	return uint32(xt)
+}
+
+func (vm *VirtualMachine) positionOf(address uint32) Position {
+	if int(address) < len(vm.positions) {
+		return vm.positions[address]
+	}
+	return Position{}
+}
+
+// Finds the name of the word whose code contains the given address.
+func (vm *VirtualMachine) wordAt(address uint32) string {
+	name, start := "<unknown word>", uint32(0)
+	for offset, wordName := range vm.names {
+		if offset <= address && offset >= start {
+			name, start = wordName, offset
+		}
+	}
+	return name
+}
+
+// Adds a function to the ones which OP_HOSTCALL can call, and returns its index.
+func (vm *VirtualMachine) addHostFunction(f func()) uint32 {
+	vm.hostFunctions = append(vm.hostFunctions, f)
+	return uint32(len(vm.hostFunctions)) - 1
+}
+
+// Returns a copy of the data stack, with the top of the stack last.
+func (vm *VirtualMachine) DataStack() []Datum {
+	return append([]Datum{}, vm.dataStack...)
+}
+
+// Likewise for the return stack.
+func (vm *VirtualMachine) ReturnStack() []Datum {
+	return append([]Datum{}, vm.returnStack...)
+}
+
+// Pushes something onto the data stack from Go code. It fails if the stack is full.
+func (vm *VirtualMachine) Push(datum Datum) error {
+	if err := vm.guard(func() { vm.pushDataStack(datum) }); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Pops the top of the data stack from Go code. It fails if the stack is empty.
+func (vm *VirtualMachine) Pop() (Datum, error) {
+	var datum Datum
+	if err := vm.guard(func() { datum = vm.popDataStack() }); err != nil {
+		return nil, err
+	}
+	return datum, nil
+}
+
+func (vm *VirtualMachine) pushDataStack(datum Datum) {
+	if len(vm.dataStack) >= vm.MaxDataStackDepth {
+		vm.throw(THROW_STACK_OVERFLOW, "stack overflow")
+	}
+	vm.dataStack = append(vm.dataStack, datum)
+}
+
+func (vm *VirtualMachine) popDataStack() Datum {
+	vm.requireDepth(1)
+	datum := vm.dataStack[len(vm.dataStack) - 1]
+  vm.dataStack = vm.dataStack[:len(vm.dataStack) - 1]
+	return datum
+}
+
+func (vm *VirtualMachine) pushInteger(n int64) {
+	vm.pushDataStack(IntegerDatum{n})
+}
+
+// Forth's canonical true flag has all bits set.
+func (vm *VirtualMachine) pushFlag(flag bool) {
+	if flag {
+		vm.pushInteger(-1)
+	} else {
+		vm.pushInteger(0)
+	}
+}
+
+func (vm *VirtualMachine) pushDouble(lo, hi uint64) {
+	vm.pushInteger(int64(lo))
+	vm.pushInteger(int64(hi))
+}
+
+func (vm *VirtualMachine) popDouble() (uint64, uint64) {
+	hi, lo := vm.popInteger(), vm.popInteger()
+	return uint64(lo), uint64(hi)
+}
+
+func (vm *VirtualMachine) popDivisor() int64 {
+	divisor := vm.popInteger()
+	if divisor == 0 {
+		vm.throw(THROW_DIVISION_BY_ZERO, "division by zero")
+	}
+	return divisor
+}
+
+func (vm *VirtualMachine) divideDouble(divide func(uint64, uint64, int64) (int64, int64, bool), lo, hi uint64, divisor int64) (int64, int64) {
+	remainder, quotient, ok := divide(lo, hi, divisor)
+	if !ok {
+		vm.throw(THROW_OUT_OF_RANGE, "result out of range")
+	}
+	return remainder, quotient
+}
+
+func (vm *VirtualMachine) popInteger() int64 {
+	datum := vm.popDataStack()
+	if datum.DataType() != TYPE_INTEGER {
+		vm.throw(THROW_TYPE_MISMATCH, "expected integer, but got %s", TypeNames[datum.DataType()])
+	}
+	return datum.(IntegerDatum).Int
+}
+
+// Makes sure that there are at least this many items on the data stack.
+func (vm *VirtualMachine) requireDepth(depth int) {
+	if len(vm.dataStack) < depth {
+		vm.throw(THROW_STACK_UNDERFLOW, "stack underflow")
+	}
+}
+
+func (vm *VirtualMachine) here() int64 {
+	return int64(len(vm.Memory))
+}
+
+// Grows (or, if size is negative, shrinks) the data space. Reports false if that would make it too big or too small.
+func (vm *VirtualMachine) resizeDataSpace(size int64) bool {
+	newSize := vm.here() + size
+	if newSize < DATA_SPACE_START || newSize > int64(vm.MaxMemorySize) {
+		return false
+	}
+	if size > 0 {
+		vm.Memory = append(vm.Memory, make([]byte, size)...)
+	} else {
+		vm.Memory = vm.Memory[:newSize]
+	}
+	return true
+}
+
+func (vm *VirtualMachine) allot(size int64) {
+	if !vm.resizeDataSpace(size) {
+		vm.throw(THROW_DICTIONARY_OVERFLOW, "can't allot %d bytes with %d already in use", size, vm.here())
+	}
+}
+
+// Rounds an address up to the next cell boundary.
+func aligned(address int64) int64 {
+	return (address + CELL_SIZE - 1) &^ (CELL_SIZE - 1)
+}
+
+// Returns the bytes of data space which start at address, or throws an error if they aren't all valid.
+func (vm *VirtualMachine) memory(address int64, length int64) []byte {
+	if length == 0 {
+		return nil
+	}
+	if address < CELL_SIZE || length < 0 || address > vm.here() - length {
+		vm.throw(THROW_INVALID_ADDRESS, "invalid memory address %d", address)
+	}
+	return vm.Memory[address:address + length]
+}
+
+func (vm *VirtualMachine) fetchCell(address int64) int64 {
+	return int64(binary.LittleEndian.Uint64(vm.memory(address, CELL_SIZE)))
+}
+
+func (vm *VirtualMachine) storeCell(address int64, value int64) {
+	binary.LittleEndian.PutUint64(vm.memory(address, CELL_SIZE), uint64(value))
+}
+
+// The address and length of the input source, which is either a line in the input buffer or a string being evaluated.
+// They're in ordinary cells that programs can store anything they like in, so they get clamped to the data space.
+func (vm *VirtualMachine) source() (int64, int64) {
+	address, length := vm.fetchCell(SOURCE_ADDRESS), vm.fetchCell(SOURCE_ADDRESS + CELL_SIZE)
+	if address < CELL_SIZE || address > vm.here() {
+		return vm.here(), 0
+	}
+	if length < 0 {
+		return address, 0
+	} else if length > vm.here() - address {
+		return address, vm.here() - address
+	}
+	return address, length
+}
+
+// Returns how far into the input source we are. Programs can store anything they like in >in, so it gets clamped.
+func (vm *VirtualMachine) inputOffset() int64 {
+	_, length := vm.source()
+	in := vm.fetchCell(TO_IN_ADDRESS)
+	if in < 0 {
+		return 0
+	} else if in > length {
+		return length
+	}
+	return in
+}
+
+// Returns the address of the part of the input source which we haven't parsed yet, and what's in it.
+func (vm *VirtualMachine) unparsed() (int64, []byte) {
+	address, length := vm.source()
+	in := vm.inputOffset()
+	return address + in, vm.memory(address + in, length - in)
+}
+
+func (vm *VirtualMachine) skipInput(n int64) {
+	vm.storeCell(TO_IN_ADDRESS, vm.inputOffset() + n)
+}
+
+// Spaces count as any kind of whitespace, so that tabs and carriage returns don't end up in the middle of words.
+func isDelimiter(char, delimiter byte) bool {
+	return char == delimiter || (delimiter == ' ' && char <= ' ')
+}
+
+func (vm *VirtualMachine) skipDelimiters(delimiter byte) {
+	_, text := vm.unparsed()
+	n := 0
+	for n < len(text) && isDelimiter(text[n], delimiter) {
+		n++
+	}
+	vm.skipInput(int64(n))
+}
+
+// Parses everything up to the next delimiter, and skips past the delimiter too. Returns the address and length of
+// what it parsed, and whether it found a delimiter before the input source ran out.
+func (vm *VirtualMachine) parse(delimiter byte) (int64, int64, bool) {
+	address, text := vm.unparsed()
+	length := 0
+	for length < len(text) && !isDelimiter(text[length], delimiter) {
+		length++
+	}
+	found := length < len(text)
+	if found {
+		vm.skipInput(int64(length + 1))
+	} else {
+		vm.skipInput(int64(length))
+	}
+	return address, int64(length), found
+}
+
+// Parses the next whitespace-delimited word. Its length is 0 if there isn't one.
+func (vm *VirtualMachine) parseName() (int64, int64) {
+	vm.skipDelimiters(' ')
+	address, length, _ := vm.parse(' ')
+	return address, length
+}
+
+// Pops the argument for 'pick' or 'roll' and makes sure there are that many items below it.
+func (vm *VirtualMachine) popDepth() int {
+	depth := vm.popInteger()
+	if depth < 0 {
+		vm.throw(THROW_OUT_OF_RANGE, "negative stack index %d", depth)
+	}
+	if depth >= int64(len(vm.dataStack)) {
+		vm.throw(THROW_STACK_UNDERFLOW, "stack underflow")
+	}
+	return int(depth)
+}
+
+func (vm *VirtualMachine) pushReturnStack(datum Datum) {
+	if len(vm.returnStack) >= vm.MaxReturnStackDepth {
+		vm.throw(THROW_RETURN_STACK_OVERFLOW, "return stack overflow")
+	}
+	vm.returnStack = append(vm.returnStack, datum)
+}
+
+func (vm *VirtualMachine) popReturnStack() Datum {
+	datum := vm.peekReturnStack(0)
+	vm.returnStack = vm.returnStack[:len(vm.returnStack) - 1]
+	return datum
+}
+
+func (vm *VirtualMachine) popReturnInteger() int64 {
+	datum := vm.popReturnStack()
+	if datum.DataType() != TYPE_INTEGER {
+		vm.throw(THROW_TYPE_MISMATCH, "expected integer on the return stack, but got %s", TypeNames[datum.DataType()])
+	}
+	return datum.(IntegerDatum).Int
+}
+
+// Returns the item which is this many places below the top of the return stack.
+func (vm *VirtualMachine) peekReturnStack(depth int) Datum {
+	if len(vm.returnStack) - vm.returnBase <= depth {
+		vm.throw(THROW_RETURN_STACK_UNDERFLOW, "return stack underflow")
+	}
+	return vm.returnStack[len(vm.returnStack) - depth - 1]
+}
+
+// Adds step to the index of the innermost counted loop and reports whether the loop should go around again. Like
+// ANS Forth, the loop ends when the index crosses the boundary between limit-1 and limit in either direction.
+func (vm *VirtualMachine) incrementLoop(step int64) bool {
+	index, limit := vm.popReturnInteger(), vm.popReturnInteger()
+	before := index - limit
+	after := before + step
+	if (before ^ after) < 0 && (before ^ step) < 0 {
+		return false
+	}
+
+	vm.pushReturnStack(IntegerDatum{limit})
+	vm.pushReturnStack(IntegerDatum{index + step})
+	return true
+}
+
+func (vm *VirtualMachine) printDisassembly() {
+	fmt.Fprintln(vm.Output, "Code disassembly:")
+	for i, instruction := range vm.Code {
+		opcode := uint8(instruction & 0xFF)
+		arg := uint32(instruction >> 8)
+
+		if uint32(i) == vm.Ip {
+			fmt.Fprint(vm.Output, "  IP> ")
+		} else {
+			fmt.Fprint(vm.Output, "      ")
+		}
+		fmt.Fprintf(vm.Output, "%04x: %08x   | %12s ", i, instruction, OpNames[opcode])
+
+		switch opcode {
+		case OP_PUSH:
+		  vm.printDatum(vm.Heap[arg], true)
+		case OP_CALL, OP_TAIL_CALL:
+			target, ok := vm.names[arg]
+			if !ok {
+				target = "<unknown routine>"
+			}
+		  fmt.Fprintf(vm.Output, "%s @ 0x%02x", target, arg)
+		case OP_JUMP, OP_JUMP_IF_NOT, OP_QDO, OP_LOOP, OP_PLUS_LOOP, OP_DOES:
+		  fmt.Fprintf(vm.Output, "%04x", arg)
+		case OP_DUP, OP_DROP, OP_HOSTCALL, OP_EMIT, OP_THROW:
+		  fmt.Fprint(vm.Output, arg)
+		}
+
+		if wordName, ok := vm.names[uint32(i)]; ok {
+			fmt.Fprintf(vm.Output, "   [%s]", wordName)
+		}
+		fmt.Fprintln(vm.Output, "")
+	}
+}
+
+func (vm *VirtualMachine) printDatum(datum Datum, escaped bool) {
+	switch datum.DataType() {
+	case TYPE_INTEGER:
+		fmt.Fprint(vm.Output, vm.formatInteger(datum.(IntegerDatum).Int))
+	case TYPE_STRING:
+		if escaped {
+			fmt.Fprintf(vm.Output, "%#v", datum.(StringDatum).Str)
+		} else {
+			fmt.Fprint(vm.Output, datum.(StringDatum).Str)
+		}
+	default:
+		vm.throw(THROW_TYPE_MISMATCH, "can't print %s", TypeNames[datum.DataType()])
+	}
+}
+
+// Returns Input with a buffer around it. If it's already buffered, we use it as it is, so that a REPL reading lines
+// from the same reader doesn't lose anything that 'key' or 'accept' should have seen.
+func (vm *VirtualMachine) inputReader() *bufio.Reader {
+	if reader, ok := vm.Input.(*bufio.Reader); ok {
+		return reader
+	}
+	if vm.input == nil || vm.inputFrom != vm.Input {
+		vm.input = bufio.NewReader(vm.Input)
+		vm.inputFrom = vm.Input
+	}
+	return vm.input
+}
+
+// Reports whether 'key' would return straight away. Reading from a terminal or a pipe waits until something arrives,
+// so for those we can only tell if something's been buffered already. Ordinary files and readers in memory never
+// make us wait, so they can look ahead.
+func (vm *VirtualMachine) keyAvailable() bool {
+	reader := vm.inputReader()
+	if reader.Buffered() > 0 {
+		return true
+	}
+	if file, ok := vm.Input.(*os.File); ok {
+		if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+	}
+	_, err := reader.Peek(1)
+	return err == nil
+}
+
+// Writes n spaces. The count could be anything, so they get written a chunk at a time.
+func (vm *VirtualMachine) writeSpaces(n int64) {
+	for ; n > 0; n -= int64(len(blanks)) {
+		chunk := blanks
+		if n < int64(len(chunk)) {
+			chunk = chunk[:n]
+		}
+		if _, err := vm.Output.Write(chunk); err != nil {
+			break
+		}
+	}
+}
+
+// Prints a number padded on the left to the given width. Like ANS says, a number that's already that wide or wider
+// gets printed as it is.
+func (vm *VirtualMachine) printRightAligned(str string, width int64) {
+	vm.writeSpaces(width - int64(len(str)))
+	fmt.Fprint(vm.Output, str)
+}
+
+// Returns BASE, which had better be something we know how to print numbers in.
+func (vm *VirtualMachine) base() int {
+	base := vm.fetchCell(BASE_ADDRESS)
+	if base < 2 || base > 36 {
+		vm.throw(THROW_INVALID_NUMERIC_ARGUMENT, "can't use numbers in base %d", base)
+	}
+	return int(base)
+}
+
+func (vm *VirtualMachine) formatInteger(n int64) string {
+	return strings.ToUpper(strconv.FormatInt(n, vm.base()))
+}
+
+func (vm *VirtualMachine) formatUnsigned(u uint64) string {
+	return strings.ToUpper(strconv.FormatUint(u, vm.base()))
+}
+
+// Returns what a character's worth as a digit in the given base, if anything.
+func digitValue(char byte, base uint64) (uint64, bool) {
+	var digit uint64
+	switch {
+	case char >= '0' && char <= '9':
+		digit = uint64(char - '0')
+	case char >= 'a' && char <= 'z':
+		digit = uint64(char - 'a' + 10)
+	case char >= 'A' && char <= 'Z':
+		digit = uint64(char - 'A' + 10)
+	default:
+		return 0, false
+	}
+	return digit, digit < base
+}
+
+// Adds a character to the start of the pictured numeric output.
+func (vm *VirtualMachine) hold(char byte) {
+	if vm.pictured <= PICTURED_BUFFER {
+		vm.throw(THROW_PICTURED_OUTPUT_OVERFLOW, "pictured numeric output is longer than %d characters", PICTURED_BUFFER_SIZE)
+	}
+	vm.pictured--
+	vm.Memory[vm.pictured] = char
+}
+
+// Divides a double-cell number by BASE, holds the remainder as a digit, and returns the quotient.
+func (vm *VirtualMachine) holdDigit(lo, hi uint64) (uint64, uint64) {
+	base := uint64(vm.base())
+	quotientHi, remainder := hi / base, hi % base
+	quotientLo, remainder := bits.Div64(remainder, lo, base)
+	vm.hold("0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"[remainder])
+	return quotientLo, quotientHi
+}
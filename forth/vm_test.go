@@ -0,0 +1,894 @@
+package forth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runCode(code string) {
+	vm := NewVirtualMachine()
+	compiler := NewCompiler(vm)
+	if err := loadAndRun(compiler, code); err != nil {
+		fmt.Print(err)
+	}
+}
+
+func runCodeWithBuiltins(code string) {
+	vm := NewVirtualMachine()
+	compiler := NewCompiler(vm)
+	if err := compiler.LoadBuiltins(); err != nil {
+		panic(err)
+	}
+	if err := loadAndRun(compiler, code); err != nil {
+		fmt.Print(err)
+	}
+}
+
+func loadAndRun(compiler *Compiler, code string) error {
+	return compiler.LoadCode(strings.NewReader(code))
+}
+
+func ExampleVirtualMachine_addition_and_printing() {
+	runCode(": foo ( -- n ) 1 2 + ; foo .")
+	// Output: 3
+}
+
+
+func ExampleVirtualMachine_modulus1() {
+	runCode("3 2 mod .")
+	// Output: 1
+}
+
+func ExampleVirtualMachine_modulus2() {
+	runCode("6 2 mod .")
+	// Output: 0
+}
+
+func ExampleVirtualMachine_dup() {
+	runCode("13 dup . .")
+	// Output: 1313
+}
+
+func ExampleVirtualMachine_over() {
+	runCode("1 2 over . . .")
+	// Output: 121
+}
+
+func ExampleVirtualMachine_two_dup() {
+	runCodeWithBuiltins("1 2 2dup . . . .")
+	// Output: 2121
+}
+
+func ExampleVirtualMachine_drop() {
+	runCode("1 2 drop .")
+	// Output: 1
+}
+
+func ExampleVirtualMachine_and() {
+	runCode("3 1 and .")
+	// Output: 1
+}
+
+func ExampleVirtualMachine_zero_equal() {
+	runCode("0 0= . 1 0= .")
+	// Output: -10
+}
+
+func ExampleVirtualMachine_if_then_true() {
+	runCode("31337 1 if . then")
+	// Output: 31337
+}
+
+func ExampleVirtualMachine_cr() {
+	runCodeWithBuiltins("1 . cr 2 .")
+	// Output:
+	// 1
+	// 2
+}
+
+func ExampleVirtualMachine_if_then_false() {
+	runCode("31337 0 if . then")
+	// Output:
+}
+
+func ExampleVirtualMachine_if_else_then_true() {
+	runCode("1 if 31337 else 69105 then .")
+	// Output: 31337
+}
+
+func ExampleVirtualMachine_if_else_then_false() {
+	runCode("0 if 31337 else 69105 then .")
+	// Output: 69105
+}
+
+func ExampleVirtualMachine_runtime_error() {
+	runCode(": foo \"a\" 1 + ;\n  foo")
+	// Output: 1:13: in 'foo': -12 expected integer, but got string
+}
+
+func TestRuntimeErrorType(t *testing.T) {
+	err := loadAndRun(NewCompiler(NewVirtualMachine()), `1 "two" mod`)
+
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("Expected a runtime error, but got %v", err)
+	}
+	if runtimeError.Word != "top-level code" || runtimeError.Pos != (Position{"", 1, 9}) {
+		t.Errorf("Runtime error has the wrong location: %v", runtimeError)
+	}
+}
+
+func ExampleVirtualMachine_stack_underflow() {
+	runCode("1 drop .")
+	// Output: 1:8: in 'top-level code': -4 stack underflow
+}
+
+func ExampleVirtualMachine_dup_underflow() {
+	runCode("1 over")
+	// Output: 1:3: in 'top-level code': -4 stack underflow
+}
+
+func ExampleVirtualMachine_unset_variable() {
+	runCode("variable foo foo @ .")
+	// Output: 0
+}
+
+func ExampleVirtualMachine_invalid_address() {
+	runCode("1 0 !")
+	// Output: 1:5: in 'top-level code': -9 invalid memory address 0
+}
+
+func ExampleVirtualMachine_return_stack_overflow() {
+	runCode(": forever recurse 1 ; forever")
+	// Output: 1:11: in 'forever': -5 return stack overflow
+}
+
+func assertThrowCode(t *testing.T, vm *VirtualMachine, code string, throwCode int) {
+	err := loadAndRun(NewCompiler(vm), code)
+
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Errorf("Expected a runtime error from %s, but got %v", code, err)
+	} else if runtimeError.Code != throwCode {
+		t.Errorf("Expected %s to throw %d, but got %v", code, throwCode, runtimeError)
+	}
+}
+
+func TestStackLimits(t *testing.T) {
+	vm := NewVirtualMachine()
+	vm.MaxDataStackDepth = 3
+	assertThrowCode(t, vm, "1 2 3 4", THROW_STACK_OVERFLOW)
+
+	vm = NewVirtualMachine()
+	vm.MaxReturnStackDepth = 2
+	assertThrowCode(t, vm, ": a 1 ; : b a a ; : c b b ; c", THROW_RETURN_STACK_OVERFLOW)
+
+	vm = NewVirtualMachine()
+	vm.MaxReturnStackDepth = 2
+	if err := loadAndRun(NewCompiler(vm), ": a 1 ; : b a ; b"); err != nil {
+		t.Errorf("Two levels of calls should fit in a return stack of depth 2, but got %v", err)
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), `"a" 1 and`, THROW_TYPE_MISMATCH)
+	assertThrowCode(t, NewVirtualMachine(), `variable foo "a" foo !`, THROW_TYPE_MISMATCH)
+}
+
+func ExampleVirtualMachine_begin_until() {
+	runCodeWithBuiltins("3 begin dup . -1 + dup 0= until drop")
+	// Output: 321
+}
+
+func ExampleVirtualMachine_begin_while_repeat() {
+	runCode(": countdown begin dup while dup . -1 + repeat drop ; 4 countdown 0 countdown")
+	// Output: 4321
+}
+
+func ExampleVirtualMachine_begin_again_leave() {
+	runCodeWithBuiltins("0 begin 1 + dup 7 mod 0= if leave then again .")
+	// Output: 7
+}
+
+func ExampleVirtualMachine_nested_loops() {
+	runCodeWithBuiltins(": inner begin dup . -1 + dup 0= until drop ; 3 begin dup inner -1 + dup 0= until drop")
+	// Output: 321211
+}
+
+func ExampleVirtualMachine_exit() {
+	runCode(": first begin 1 if 42 exit then again ; first .")
+	// Output: 42
+}
+
+func ExampleVirtualMachine_do_loop() {
+	runCode("5 0 do i . loop")
+	// Output: 01234
+}
+
+func ExampleVirtualMachine_nested_do_loops() {
+	runCode(`: table 3 1 do 3 1 do j . i . "," . loop loop ; table`)
+	// Output: 11,12,21,22,
+}
+
+func ExampleVirtualMachine_negative_plus_loop() {
+	runCode("-3 3 do i . -2 +loop")
+	// Output: 31-1-3
+}
+
+func ExampleVirtualMachine_question_do() {
+	runCode(`3 3 ?do "never" . loop 4 3 ?do i . loop`)
+	// Output: 3
+}
+
+func ExampleVirtualMachine_leave_do_loop() {
+	runCode("100 0 do i . i 3 mod 2 and if leave then loop 42 .")
+	// Output: 01242
+}
+
+func ExampleVirtualMachine_leave_do_loop_from_begin() {
+	runCode(": foo 3 0 do begin leave again i . loop 42 . ; foo")
+	// Output: 42
+}
+
+func ExampleVirtualMachine_unloop_exit() {
+	runCode(": find-four 10 0 do i 4 and if i unloop exit then loop -1 ; find-four .")
+	// Output: 4
+}
+
+func ExampleVirtualMachine_loop_index_outside_loop() {
+	runCode("i .")
+	// Output: 1:1: in 'top-level code': -6 return stack underflow
+}
+
+func assertStack(t *testing.T, code string, expected ...int64) {
+	vm := NewVirtualMachine()
+	if err := loadAndRun(NewCompiler(vm), code); err != nil {
+		t.Errorf("Unexpected error running %s: %v", code, err)
+		return
+	}
+
+	actual := []int64{}
+	for _, datum := range vm.dataStack {
+		actual = append(actual, datum.(IntegerDatum).Int)
+	}
+	if fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("Expected %s to leave %v on the stack, but got %v", code, expected, actual)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	assertStack(t, "7 3 -", 4)
+	assertStack(t, "7 -3 *", -21)
+	assertStack(t, "7 2 / -7 2 /", 3, -3)
+	assertStack(t, "7 2 /mod -7 2 /mod", 1, 3, -1, -3)
+	assertStack(t, "3 negate -4 abs 4 abs", -3, 4, 4)
+	assertStack(t, "3 5 min 3 5 max -1 -2 min", 3, 5, -2)
+	assertStack(t, "5 1+ 5 1- 5 2* -5 2/", 6, 4, 10, -3)
+	assertStack(t, "1000000000000 1000000000000 1000000 */", 1000000000000000000)
+	assertStack(t, "10 7 3 */mod", 1, 23)
+}
+
+func TestLogic(t *testing.T) {
+	assertStack(t, "12 10 and 12 10 or 12 10 xor", 8, 14, 6)
+	assertStack(t, "0 invert 5 invert", -1, -6)
+	assertStack(t, "1 4 lshift 256 4 rshift -1 60 rshift 1 64 lshift", 16, 16, 15, 0)
+}
+
+func TestComparisons(t *testing.T) {
+	assertStack(t, "1 1 = 1 2 = 1 2 <>", -1, 0, -1)
+	assertStack(t, "1 2 < 2 1 < -1 1 > 1 -1 >", -1, 0, 0, -1)
+	assertStack(t, "1 -1 u< -1 1 u>", -1, -1)
+	assertStack(t, "0 0= 5 0= 0 0<> -5 0< 5 0< 5 0> -5 0>", -1, 0, 0, -1, 0, -1, 0)
+	assertStack(t, "5 1 10 within 10 1 10 within -1 -5 5 within", -1, 0, -1)
+}
+
+func TestDoubleCellArithmetic(t *testing.T) {
+	assertStack(t, "5 s>d -5 s>d", 5, 0, -5, -1)
+	assertStack(t, "-3 4 m* -1 -1 um*", -12, -1, 1, -2)
+	assertStack(t, "7 0 2 um/mod", 1, 3)
+	assertStack(t, "-7 s>d 2 fm/mod 7 s>d -2 fm/mod 7 s>d 2 fm/mod", 1, -4, -1, -4, 1, 3)
+	assertStack(t, "-7 s>d 2 sm/rem 7 s>d -2 sm/rem", -1, -3, 1, -3)
+	assertStack(t, "1 -1 um* 2 um/mod", 1, 9223372036854775807)
+}
+
+func TestDivisionErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), "1 0 /", THROW_DIVISION_BY_ZERO)
+	assertThrowCode(t, NewVirtualMachine(), "1 0 mod", THROW_DIVISION_BY_ZERO)
+	assertThrowCode(t, NewVirtualMachine(), "1 1 0 */", THROW_DIVISION_BY_ZERO)
+	assertThrowCode(t, NewVirtualMachine(), "1 s>d 0 fm/mod", THROW_DIVISION_BY_ZERO)
+	assertThrowCode(t, NewVirtualMachine(), "0 1 1 um/mod", THROW_OUT_OF_RANGE)
+	assertThrowCode(t, NewVirtualMachine(), "0 1 1 sm/rem", THROW_OUT_OF_RANGE)
+}
+
+func TestStackManipulation(t *testing.T) {
+	assertStack(t, "1 2 swap", 2, 1)
+	assertStack(t, "1 2 3 rot", 2, 3, 1)
+	assertStack(t, "1 2 3 -rot", 3, 1, 2)
+	assertStack(t, "1 2 nip", 2)
+	assertStack(t, "1 2 tuck", 2, 1, 2)
+	assertStack(t, "1 2 3 0 pick 1 2 3 2 pick", 1, 2, 3, 3, 1, 2, 3, 1)
+	assertStack(t, "1 2 3 2 roll 1 2 3 0 roll", 2, 3, 1, 1, 2, 3)
+	assertStack(t, "0 ?dup 5 ?dup", 0, 5, 5)
+	assertStack(t, "depth 7 depth", 0, 7, 2)
+	assertStack(t, "1 2 2dup", 1, 2, 1, 2)
+	assertStack(t, "1 2 3 4 2swap", 3, 4, 1, 2)
+	assertStack(t, "1 2 3 4 2over", 1, 2, 3, 4, 1, 2)
+	assertStack(t, "1 2 3 4 5 6 2rot", 3, 4, 5, 6, 1, 2)
+}
+
+func TestReturnStackWords(t *testing.T) {
+	assertStack(t, ": foo >r 1 r@ r> ; 5 foo", 1, 5, 5)
+	assertStack(t, ": foo 2>r 2r@ 2r> ; 1 2 foo", 1, 2, 1, 2)
+	assertStack(t, ": foo 1 >r 2 >r r> r> - ; foo", 1)
+}
+
+func TestStackManipulationErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), "1 swap", THROW_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), "1 2 rot", THROW_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), "1 2 2 pick", THROW_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), "1 2 -1 roll", THROW_OUT_OF_RANGE)
+	assertThrowCode(t, NewVirtualMachine(), "1 2 3 2rot", THROW_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), ": foo r> r> ; foo", THROW_RETURN_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), `: foo "oops" >r ; foo`, THROW_TYPE_MISMATCH)
+
+	// Top-level code keeps its return address on the return stack, so these only work inside definitions.
+	var compileError *CompileError
+	for _, code := range []string{"3 >r 4 .", "r@", "1 if 3 >r then", ": foo [ 1 2 2>r ] ;"} {
+		if err := loadAndRun(NewCompiler(NewVirtualMachine()), code); !errors.As(err, &compileError) || compileError.Code != THROW_COMPILE_ONLY {
+			t.Errorf("Expected %s to be a compile-only error, but got %v", code, err)
+		}
+	}
+	if err := loadAndRun(NewCompiler(NewVirtualMachine()), "' r> execute"); !errors.As(err, &compileError) {
+		t.Errorf("Expected r> not to have an execution token, but got %v", err)
+	}
+	assertStack(t, `: foo s" 3 >r" evaluate ; ' foo catch`, THROW_COMPILE_ONLY)
+}
+
+func TestDataSpace(t *testing.T) {
+	assertStack(t, "here 3 allot here swap -", 3)
+	assertStack(t, "here 42 , @", 42)
+	assertStack(t, "here 7 c, 300 c, dup c@ swap char+ c@", 7, 44)
+	assertStack(t, "here 0 , 5 over +! 2 over +! @", 7)
+	assertStack(t, "3 cells 0 cell+ 5 chars", 24, 8, 5)
+	assertStack(t, "1 aligned 8 aligned 9 aligned", 8, 8, 16)
+	assertStack(t, "1 allot align here 8 mod", 0)
+}
+
+func TestArrays(t *testing.T) {
+	assertStack(t, `
+		: array-sum ( addr n -- sum ) 0 -rot 0 do dup i cells + @ rot + swap loop drop ;
+		here 5 cells allot
+		5 0 do i i * over i cells + ! loop
+		5 array-sum`, 30)
+}
+
+func TestFillMoveErase(t *testing.T) {
+	assertStack(t, "here 4 allot dup 4 65 fill dup c@ swap 3 + c@", 65, 65)
+	assertStack(t, "here 4 allot dup 4 65 fill dup 4 erase dup c@ swap 3 + c@", 0, 0)
+	assertStack(t, "here 8 allot dup 4 7 fill dup dup 2 + 4 move dup 5 + c@ swap 6 + c@", 7, 0)
+	assertStack(t, "0 0 0 move 0 0 erase 0 0 65 fill")
+}
+
+func TestMemoryErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), "0 @", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "here @", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "here 4 allot @", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "-1 c@", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "here 4 allot -1 8 fill", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "-8 allot", THROW_DICTIONARY_OVERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), "1000000000 allot", THROW_DICTIONARY_OVERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), `"str" here !`, THROW_TYPE_MISMATCH)
+}
+
+func TestDefiningWords(t *testing.T) {
+	assertStack(t, "variable foo 5 foo ! foo @ 1 foo +! foo @", 5, 6)
+	assertStack(t, "variable foo variable bar foo bar - abs", CELL_SIZE)
+	assertStack(t, "2variable foo 1 2 foo 2! foo 2@", 1, 2)
+	assertStack(t, "42 constant answer answer answer", 42, 42)
+	assertStack(t, "1 2 2constant pair pair", 1, 2)
+	assertStack(t, "3 value foo foo 4 to foo foo", 3, 4)
+	assertStack(t, "3 value foo : bump foo 1+ to foo ; bump bump foo", 5)
+	assertStack(t, "1 c, 16 buffer: buf buf 16 + here = buf aligned buf =", -1, -1)
+	assertStack(t, "variable x : foo x @ ; 7 x ! foo", 7)
+}
+
+func ExampleVirtualMachine_string_constant() {
+	runCode(`"hello" constant greeting greeting .`)
+	// Output: hello
+}
+
+func TestRedefiningBuiltIns(t *testing.T) {
+	for _, code := range []string{": dup 42 ;", ": EMIT drop ;", ": s\" 1 ;", "variable swap", "5 constant evaluate", "defer create"} {
+		err := loadAndRun(NewCompiler(NewVirtualMachine()), code)
+		var compileError *CompileError
+		if !errors.As(err, &compileError) || compileError.Code != THROW_INVALID_NAME {
+			t.Errorf("Expected %s to fail, since it redefines a built-in word, but got %v", code, err)
+		}
+	}
+
+	// Only the compiler's own words are special. Case-sensitive systems and words written in Forth are fair game.
+	vm := NewVirtualMachine()
+	vm.CaseSensitive = true
+	if err := loadAndRun(NewCompiler(vm), ": DUP 42 ;"); err != nil {
+		t.Errorf("Expected DUP to be a different word from dup, but got %v", err)
+	}
+	assertStack(t, ": true 1 ; : true true 1+ ; true", 2)
+}
+
+func TestDefiningWordErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), "constant foo", THROW_STACK_UNDERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), `"a" value foo`, THROW_TYPE_MISMATCH)
+	assertThrowCode(t, NewVirtualMachine(), "-1 buffer: foo", THROW_OUT_OF_RANGE)
+	assertThrowCode(t, NewVirtualMachine(), "2000000 buffer: foo", THROW_DICTIONARY_OVERFLOW)
+}
+
+func TestCreateDoes(t *testing.T) {
+	assertStack(t, "create foo 1 , 2 , foo @ foo cell+ @", 1, 2)
+	assertStack(t, "create foo here foo =", -1)
+	assertStack(t, ": array create cells allot does> swap cells + ; 5 array foo 7 3 foo ! 3 foo @ 0 foo here 5 cells - =", 7, -1)
+	assertStack(t, ": const create , does> @ ; 42 const answer 7 const seven answer seven", 42, 7)
+	assertStack(t, ": counter create 0 , does> 1 over +! @ ; counter c c c c", 1, 2, 3)
+	assertStack(t, ": var variable ; var x 5 x ! x @", 5)
+}
+
+func TestToBody(t *testing.T) {
+	vm := NewVirtualMachine()
+	c := NewCompiler(vm)
+	mustLoad(t, c, "create foo 3 , : bar ;")
+
+	vm.pushInteger(int64(vm.Dict["foo"]))
+	if err := vm.Execute(primitiveAddress(t, c, ">body")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if vm.popInteger() != vm.Heap[0].(IntegerDatum).Int {
+		t.Errorf("Expected >body to return the address that foo pushes")
+	}
+
+	vm.pushInteger(int64(vm.Dict["bar"]))
+	if err := vm.Execute(primitiveAddress(t, c, ">body")); err == nil {
+		t.Errorf("Expected >body to fail on a word that wasn't made by create")
+	}
+}
+
+// Compiles a word which does nothing but the given primitive, and returns its address.
+func primitiveAddress(t *testing.T, c *Compiler, name string) uint32 {
+	mustLoad(t, c, ": call-primitive " + name + " ;")
+	return c.vm.Dict["call-primitive"]
+}
+
+func ExampleVirtualMachine_does_without_create() {
+	runCode(": foo does> 1 ; : bar ; foo")
+	// Output: 1:7: in 'foo': -31 'does>' can only change a word made by 'create'
+}
+
+func ExampleVirtualMachine_create_without_name() {
+	runCode(": foo create ; foo")
+	// Output: 1:7: in 'foo': -16 'create' expected a name after it
+}
+
+func TestImmediateWords(t *testing.T) {
+	assertStack(t, ": five 5 ; immediate : foo five ; foo", 5)
+	assertStack(t, ": foo [ 2 3 + ] literal ; foo foo", 5, 5)
+	assertStack(t, ": lit5 5 postpone literal ; immediate : foo lit5 ; foo", 5)
+	assertStack(t, ": compile-dup postpone dup ; immediate : foo compile-dup ; 3 foo", 3, 3)
+	assertStack(t, ": unless postpone 0= postpone if ; immediate : foo unless 1 else 2 then ; 0 foo 5 foo", 1, 2)
+	assertStack(t, ": my-if [compile] if ; immediate : foo my-if 1 then ; -1 foo 0 foo", 1)
+	assertStack(t, ": foo [compile] dup ; 4 foo", 4, 4)
+	assertStack(t, ": compiling? state @ ; immediate : foo compiling? literal ; foo state @", -1, 0)
+	assertStack(t, ": bar 7 ; : call-bar postpone bar ; immediate : foo call-bar call-bar ; foo", 7, 7)
+	assertStack(t, ": foo 1 ; : bar postpone foo ; immediate : foo 2 ; : baz bar ; baz", 1)
+	assertStack(t, ": foo 1 ; : bar postpone foo ; immediate : foo 2 ; : bar2 postpone foo ; immediate : baz bar bar2 ; baz", 1, 2)
+	assertStack(t, ": my-begin postpone begin ; immediate : my-until postpone until ; immediate : foo 0 my-begin 1+ dup 3 = my-until ; foo", 3)
+}
+
+func TestImmediateWordErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), ": foo postpone if ; foo", THROW_COMPILE_ONLY)
+	assertThrowCode(t, NewVirtualMachine(), ": foo literal ;", THROW_STACK_UNDERFLOW)
+}
+
+func TestExecutionTokens(t *testing.T) {
+	assertStack(t, ": foo 5 ; ' foo execute", 5)
+	assertStack(t, "3 ' dup execute 2 ' over execute", 3, 3, 2, 3)
+	assertStack(t, "' dup ' dup =", -1)
+	assertStack(t, ": foo ['] 1+ ; 1 foo execute", 2)
+	assertStack(t, ": apply ( n xt -- n' ) execute ; 4 ' 2* apply", 8)
+	assertStack(t, "' variable execute foo 6 foo ! foo @", 6)
+	assertStack(t, ": name-of ' ; : bar 9 ; name-of bar execute", 9)
+	assertStack(t, `
+		: add + ; : sub - ;
+		create ops ' add , ' sub ,
+		: op ( n1 n2 i -- n ) cells ops + @ execute ;
+		10 3 0 op 10 3 1 op`, 13, 7)
+}
+
+func TestDeferredWords(t *testing.T) {
+	assertStack(t, "defer foo ' 1+ is foo 1 foo ' 2* is foo 5 foo", 2, 10)
+	assertStack(t, "defer foo : bar foo ; ' negate is foo 3 bar", -3)
+	assertStack(t, "defer foo : set-foo ['] dup is foo ; set-foo 7 foo", 7, 7)
+	assertStack(t, "defer foo ' abs is foo action-of foo ' abs =", -1)
+	assertStack(t, "defer foo : get action-of foo ; ' abs is foo get ' abs =", -1)
+}
+
+func TestRecursion(t *testing.T) {
+	assertStack(t, ": factorial ( n -- n! ) dup 1 > if dup 1- recurse * then ; 10 factorial", 3628800)
+	assertStack(t, ": fib ( n -- fib ) dup 2 < if exit then dup 1- recurse swap 2 - recurse + ; 20 fib", 6765)
+	assertStack(t, ": countdown ( n -- ) ?dup if 1- recurse then ; 1000 countdown depth", 0)
+
+	// Words which call each other need a deferred word, since neither can see the other until it's defined.
+	evenOdd := "defer even? : odd? ( n -- flag ) ?dup if 1- even? else 0 then ; " +
+		": (even?) ( n -- flag ) ?dup if 1- odd? else -1 then ; ' (even?) is even? "
+	assertStack(t, evenOdd + "300 even? 301 even? 300 odd? 301 odd?", -1, 0, 0, -1)
+
+	vm := NewVirtualMachine()
+	vm.MaxReturnStackDepth = 100000
+	if err := loadAndRun(NewCompiler(vm), ": deep ( n -- n ) dup if 1- recurse 1+ then ; 50000 deep"); err != nil {
+		t.Fatalf("Unexpected error from deep recursion: %v", err)
+	}
+	if len(vm.dataStack) != 1 || vm.dataStack[0] != (IntegerDatum{50000}) {
+		t.Errorf("Expected 50000 on the stack, but got %v", vm.dataStack)
+	}
+
+	assertStack(t, ": bottomless recurse 1 ; ' bottomless catch", THROW_RETURN_STACK_OVERFLOW)
+	assertStack(t, evenOdd + ": deep-even ['] even? catch ; 100000 deep-even nip", THROW_RETURN_STACK_OVERFLOW)
+}
+
+func TestTailCalls(t *testing.T) {
+	// A million levels of tail recursion fit in a return stack which only has room for the top-level code.
+	vm := NewVirtualMachine()
+	vm.MaxReturnStackDepth = 1
+	code := ": count-down ( n -- 0 ) dup if 1- recurse then ; " +
+		": even? ( n -- flag ) dup 0= if drop -1 else 1- dup 0= if drop 0 else 1- recurse then then ; " +
+		"1000000 count-down 1000000 even? 999999 even?"
+	if err := loadAndRun(NewCompiler(vm), code); err != nil {
+		t.Fatalf("Unexpected error from tail recursion: %v", err)
+	}
+	expected := []Datum{IntegerDatum{0}, IntegerDatum{-1}, IntegerDatum{0}}
+	if fmt.Sprint(vm.dataStack) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v on the stack, but got %v", expected, vm.dataStack)
+	}
+
+	vm = NewVirtualMachine()
+	c := NewCompiler(vm)
+	c.NoTailCalls = true
+	var runtimeError *RuntimeError
+	if err := loadAndRun(c, ": count-down dup if 1- recurse then ; 1000000 count-down"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_RETURN_STACK_OVERFLOW {
+		t.Errorf("Expected a return stack overflow without tail calls, but got %v", err)
+	}
+
+	// Calls that still have work to do afterwards have to come back.
+	assertStack(t, ": add-one 1+ ; : looped 0 3 0 do add-one loop ; looped", 3)
+	assertStack(t, ": second 2 ; : first >r second r> ; 1 first", 2, 1)
+	assertStack(t, ": inner 1 ; : outer 0 begin inner + dup 5 = until ; outer", 5)
+}
+
+func TestExecutionTokenErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), "-5 execute", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), "defer foo foo", THROW_INVALID_ADDRESS)
+	assertThrowCode(t, NewVirtualMachine(), ": foo ' ; foo nothing", THROW_UNDEFINED_WORD)
+}
+
+func ExampleVirtualMachine_strings() {
+	runCode(`s" hello, world" type : greet ." hi there" ; greet ."  and bye"`)
+	// Output: hello, worldhi there and bye
+}
+
+func ExampleVirtualMachine_escaped_strings() {
+	runCode(`s\" tab\there\n\x41\"" type : foo s\" \\q\q" type ; foo`)
+	// Output:
+	// tab	here
+	// A"\q"
+}
+
+func ExampleVirtualMachine_counted_strings() {
+	runCode(`: foo c" counted" ; foo count type foo c@ .`)
+	// Output: counted7
+}
+
+func TestStringWords(t *testing.T) {
+	assertStack(t, `s" abc" swap c@`, 3, 'a')
+	assertStack(t, `s" one" nip s" three" nip`, 3, 5)
+	assertStack(t, `s" one" drop s" three" drop <>`, -1)
+	assertStack(t, `: foo s" compiled" ; foo nip foo drop foo drop =`, 8, -1)
+	assertStack(t, `s" " nip`, 0)
+}
+
+func TestInputSourceWords(t *testing.T) {
+	assertStack(t, "source nip", 10)
+	assertStack(t, ">in @", 5)
+	assertStack(t, "1 source nip >in ! 2", 1)
+	assertStack(t, "41 parse abc) nip 2", 3, 2)
+	assertStack(t, "parse-name   hello nip", 5)
+	assertStack(t, "32 word   hi  count nip 46 word ..xyz. c@", 2, 3)
+	assertStack(t, "refill 1\n2 3", -1, 2, 3)
+
+	// SOURCE lives in ordinary cells, so programs can store nonsense in it.
+	assertStack(t, "-5 40 ! 1\n2", 2)
+	assertStack(t, "-5 32 ! 1\n2", 2)
+	assertStack(t, "1000000000 40 ! 1\n2", 1, 2)
+}
+
+func TestEvaluate(t *testing.T) {
+	assertStack(t, `s" 1 2 +" evaluate`, 3)
+	assertStack(t, `s" 1" evaluate 2`, 1, 2)
+	assertStack(t, `s" : foo 42 ;" evaluate foo`, 42)
+	assertStack(t, `: twice s" 2 *" evaluate ; 5 twice`, 10)
+	assertStack(t, `s" refill" evaluate`, 0)
+	assertStack(t, `: inner s" 7" evaluate ; s" inner 8" evaluate`, 7, 8)
+}
+
+func writeTempFile(t *testing.T, dir string, name string, code string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goforth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inner := writeTempFile(t, dir, "inner.fs", "2\n: five 5 ;")
+	outer := writeTempFile(t, dir, "outer.fs", "1 include " + inner + " 3\n4 five")
+
+	assertStack(t, "include " + outer, 1, 2, 3, 4, 5)
+	assertStack(t, "s\" " + inner + "\" included five", 2, 5)
+}
+
+func TestInputSourceErrors(t *testing.T) {
+	assertThrowCode(t, NewVirtualMachine(), `s" 1 0 /" evaluate`, THROW_DIVISION_BY_ZERO)
+	assertThrowCode(t, NewVirtualMachine(), `s" frobnicate" evaluate`, THROW_UNDEFINED_WORD)
+	assertThrowCode(t, NewVirtualMachine(), `: loopy s" loopy" evaluate ; loopy`, THROW_RETURN_STACK_OVERFLOW)
+	assertThrowCode(t, NewVirtualMachine(), "include nowhere.fs", THROW_NONEXISTENT_FILE)
+	assertThrowCode(t, NewVirtualMachine(), "32 word " + strings.Repeat("x", 300), THROW_PARSED_STRING_OVERFLOW)
+
+	// Errors in the code being interpreted get their own codes, so that 'catch' can tell them apart.
+	tests := []struct{ code string; throwCode int }{
+		{`s" frobnicate"`, THROW_UNDEFINED_WORD},
+		{`s" recurse"`, THROW_COMPILE_ONLY},
+		{`s" :"`, THROW_ZERO_LENGTH_NAME},
+		{`s" include"`, THROW_ZERO_LENGTH_NAME},
+		{`s\" \"unterminated"`, THROW_UNEXPECTED_EOF},
+		{`s" 1 then"`, THROW_CONTROL_MISMATCH},
+		{`s\" s\\\" \\y\""`, THROW_INVALID_ESCAPE},
+	}
+	for _, test := range tests {
+		assertStack(t, test.code + " ' evaluate catch nip nip", int64(test.throwCode))
+	}
+}
+
+func ExampleVirtualMachine_evaluate_error() {
+	runCode(`s" 1 0 /" evaluate`)
+	// Output: evaluate:1:5: in 'top-level code': -10 division by zero
+}
+
+func ExampleVirtualMachine_char() {
+	runCodeWithBuiltins(": foo [char] B . ; char A . foo \\ char C .")
+	// Output: 6566
+}
+
+func TestCaseInsensitivity(t *testing.T) {
+	assertStack(t, ": Foo 1 DUP + ; foo FOO", 2, 2)
+	assertStack(t, "VARIABLE X 5 x ! X @ 3 Value v v", 5, 3)
+	assertStack(t, ": bar 3 0 DO I LOOP ; BAR ' Bar : baz ['] BAR ; baz =", 0, 1, 2, -1)
+	assertStack(t, `S" abc" Nip`, 3)
+}
+
+func TestCaseSensitivity(t *testing.T) {
+	vm := NewVirtualMachine()
+	vm.CaseSensitive = true
+	c := NewCompiler(vm)
+	if err := loadAndRun(c, ": foo 1 ; : FOO 2 ; foo FOO"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if fmt.Sprint(vm.dataStack) != "[{1} {2}]" {
+		t.Errorf("Expected foo and FOO to be different words, but got %v", vm.dataStack)
+	}
+
+	var compileError *CompileError
+	if err := loadAndRun(c, "1 DUP"); !errors.As(err, &compileError) {
+		t.Errorf("Expected DUP to be undefined, but got %v", err)
+	}
+}
+
+func ExampleVirtualMachine_names_keep_their_case() {
+	runCode(": Divide 0 / ; 1 DIVIDE")
+	// Output: 1:12: in 'Divide': -10 division by zero
+}
+
+func TestBase(t *testing.T) {
+	assertStack(t, "16 base ! ff a base ! 10", 255, 10)
+	assertStack(t, "2 base ! 101 #101 $FFFFFFFFFFFFFFFF", 5, 101, -1)
+	assertStack(t, ": add 1 ; 16 base ! add", 1)
+	assertStack(t, "16 base ! : add + ; variable face 2 face ! 1 face @ add", 3)
+	assertStack(t, "16 base ! 10 constant dad 20 value cab : bee dad cab + ; bee", 0x30)
+	assertStack(t, "20 base ! 3 0 do i loop 1b", 0, 1, 2, 31)
+	assertStack(t, `0 0 s" 123xyz" >number nip`, 123, 0, 3)
+	assertStack(t, `16 base ! 1 0 s" fF" >number nip`, 0x1ff, 0, 0)
+	assertStack(t, `0 0 s" 18446744073709551617" >number 2drop`, 1, 1)
+	assertThrowCode(t, NewVirtualMachine(), ": foo 0 base ! 5 . ; foo", THROW_INVALID_NUMERIC_ARGUMENT)
+}
+
+func ExampleVirtualMachine_base() {
+	runCodeWithBuiltins("255 hex . cr decimal 255 . cr binary 101 . cr decimal -1 u. cr 42 5 .r -7 4 .r 7 3 u.r")
+	// Output:
+	// FF
+	// 255
+	// 101
+	// 18446744073709551615
+	//    42  -7  7
+}
+
+func ExampleVirtualMachine_pictured_numeric_output() {
+	runCodeWithBuiltins(`: money ( n -- ) dup abs 0 <# # # [char] . hold #s rot sign [char] $ hold #> type ;
+		-12345 money cr 7 money cr
+		-1 -1 <# #s #> type cr
+		255 hex 0 <# #s s" 0x" holds #> type decimal cr
+		5 2 base ! s>d <# # # # # #> type`)
+	// Output:
+	// $-123.45
+	// $0.07
+	// 340282366920938463463374607431768211455
+	// 0xFF
+	// 0101
+}
+
+func TestPicturedOutputOverflow(t *testing.T) {
+	assertStack(t, "-1 -1 <# 2 base ! #s #> nip", 128)
+	assertThrowCode(t, NewVirtualMachine(), ": foo <# 300 0 do 65 hold loop ; foo", THROW_PICTURED_OUTPUT_OVERFLOW)
+}
+
+func runWithIO(t *testing.T, code string, input string) string {
+	var output bytes.Buffer
+	vm := NewVirtualMachine()
+	vm.Output = &output
+	vm.Input = strings.NewReader(input)
+	if err := loadAndRun(NewCompiler(vm), code); err != nil {
+		t.Errorf("Unexpected error running %s: %v", code, err)
+	}
+	return output.String()
+}
+
+func TestInputAndOutput(t *testing.T) {
+	tests := []struct{ code, input, output string }{
+		{`65 emit space 66 emit cr 3 spaces 0 spaces -1 spaces ." x" 12 . s" yz" type`, "", "A B\n   x12yz"},
+		{"150 spaces 1 .", "", strings.Repeat(" ", 150) + "1"},
+		{"5 2000000 .r", "", strings.Repeat(" ", 1999999) + "5"},
+		{"2 -3 .r 123 2 .r 4 -1 u.r", "", "21234"},
+		{"key emit key emit key .", "hi", "hi-1"},
+		{"key? . key drop key? .", "x", "-10"},
+		{"create buf 10 allot buf 10 accept buf swap type buf 10 accept .", "hello\r\nworld", "hello5"},
+		{"create buf 10 allot buf 10 accept buf swap type", "abcdefghijklmno\n", "abcdefghij"},
+	}
+	for _, test := range tests {
+		if output := runWithIO(t, test.code, test.input); output != test.output {
+			t.Errorf("Expected %s to print %q, but got %q", test.code, test.output, output)
+		}
+	}
+}
+
+func TestKeyQuestionDoesNotWaitForPipe(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	vm := NewVirtualMachine()
+	vm.Input = reader
+	done := make(chan error)
+	go func() { done <- loadAndRun(NewCompiler(vm), "key?") }()
+	select {
+	case err := <-done:
+		if err != nil || len(vm.dataStack) != 1 || vm.dataStack[0] != (IntegerDatum{0}) {
+			t.Errorf("Expected key? to say there's nothing to read, but got %v and %v", vm.dataStack, err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected key? not to wait for input from a pipe")
+	}
+}
+
+func TestSeparateOutputs(t *testing.T) {
+	var one, two bytes.Buffer
+	vm1, vm2 := NewVirtualMachine(), NewVirtualMachine()
+	vm1.Output, vm2.Output = &one, &two
+	c1, c2 := NewCompiler(vm1), NewCompiler(vm2)
+	loadAndRun(c1, "1 .")
+	loadAndRun(c2, "2 .")
+	loadAndRun(c1, "3 .")
+	if one.String() != "13" || two.String() != "2" {
+		t.Errorf("Expected each VM to have its own output, but got %q and %q", one.String(), two.String())
+	}
+}
+
+func TestCatchAndThrow(t *testing.T) {
+	assertStack(t, ": ok 1 2 ; ' ok catch", 1, 2, 0)
+	assertStack(t, ": oops 99 throw ; 5 ' oops catch", 5, 99)
+	assertStack(t, ": nothing 0 throw 3 ; ' nothing catch", 3, 0)
+	assertStack(t, ": messy 1 2 3 4 -7 throw ; 10 ' messy catch", 10, -7)
+	assertStack(t, ": greedy drop drop drop -7 throw ; 1 2 3 ' greedy catch nip nip nip depth", -7, 1)
+	assertStack(t, ": deep 1 >r 2 >r -3 throw ; : shallow ['] deep catch ; shallow", -3)
+	assertStack(t, ": inner -5 throw ; : outer ['] inner catch 1+ throw ; ' outer catch", -4)
+	assertStack(t, ": unwind 10 0 do i 5 = if i throw then loop ; ' unwind catch", 5)
+}
+
+func TestCatchNestedTooDeeply(t *testing.T) {
+	vm := NewVirtualMachine()
+	vm.MaxReturnStackDepth = 100
+	if err := loadAndRun(NewCompiler(vm), "variable v : w v @ catch ; ' w v ! w"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(vm.dataStack) == 0 || vm.dataStack[0] != (IntegerDatum{THROW_RETURN_STACK_OVERFLOW}) {
+		t.Errorf("Expected the innermost catch to get a return stack overflow, but got %v", vm.dataStack)
+	}
+	if len(vm.returnStack) != 0 {
+		t.Errorf("Expected the exception frames to be gone from the return stack, but got %v", vm.returnStack)
+	}
+}
+
+func TestCatchingRuntimeErrors(t *testing.T) {
+	assertStack(t, ": underflow drop ; ' underflow catch", THROW_STACK_UNDERFLOW)
+	assertStack(t, ": divide 1 0 / ; ' divide catch", THROW_DIVISION_BY_ZERO)
+	assertStack(t, `: mismatch "a" 1 + ; ' mismatch catch`, THROW_TYPE_MISMATCH)
+	assertStack(t, `: undefined s" frobnicate" evaluate ; ' undefined catch`, THROW_UNDEFINED_WORD)
+	assertStack(t, `: half-defined s" : broken [ 1 0 / ] ;" evaluate ; ' half-defined catch 1`, THROW_DIVISION_BY_ZERO, 1)
+	assertStack(t, `s" 1 2 3 0 0 /" ' evaluate catch nip nip source nip`, THROW_DIVISION_BY_ZERO, 51)
+}
+
+func ExampleVirtualMachine_uncaught_throw() {
+	runCode(": oops -4 throw ; oops")
+	// Output: 1:11: in 'oops': -4 stack underflow
+}
+
+func ExampleVirtualMachine_abort() {
+	runCodeWithBuiltins(`: check ( n -- ) dup 0< abort" negative!" . ; 5 check -1 check`)
+	// Output: 51:25: in 'check': -2 negative!
+}
+
+func ExampleVirtualMachine_uncaught_abort() {
+	runCode(": check ( n -- )\n  0< if abort then ;\n1 check -1 check")
+	// Output: 2:9: in 'check': -1 aborted
+}
+
+func TestAbort(t *testing.T) {
+	vm := NewVirtualMachine()
+	c := NewCompiler(vm)
+	if err := c.LoadBuiltins(); err != nil {
+		t.Fatal(err)
+	}
+	var runtimeError *RuntimeError
+	if err := loadAndRun(c, "1 2 3 abort"); !errors.As(err, &runtimeError) || runtimeError.Code != THROW_ABORT {
+		t.Errorf("Expected abort to throw -1, but got %v", err)
+	}
+	if len(vm.dataStack) != 0 {
+		t.Errorf("Expected abort to empty the stack, but it has %d things on it", len(vm.dataStack))
+	}
+
+	if err := loadAndRun(c, `: maybe abort" nope" ; 1 2 ' abort catch 3 ' maybe catch nip 0 ' maybe catch`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Datum{IntegerDatum{1}, IntegerDatum{2}, IntegerDatum{THROW_ABORT}, IntegerDatum{THROW_ABORT_QUOTE}, IntegerDatum{0}}
+	if fmt.Sprint(vm.dataStack) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v on the stack, but got %v", expected, vm.dataStack)
+	}
+	if err := loadAndRun(c, `abort" nope"`); err == nil {
+		t.Errorf("Expected abort\" to be compile-only")
+	}
+}
+
+func TestCatchLetsByeThrough(t *testing.T) {
+	var bye *Bye
+	if err := loadAndRun(NewCompiler(NewVirtualMachine()), "3 ' (bye) catch"); !errors.As(err, &bye) || bye.Code != 3 {
+		t.Errorf("Expected catch not to catch bye, but got %v", err)
+	}
+}
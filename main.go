@@ -1,15 +1,123 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"os"
+	"strings"
+
+	"github.com/fimmtiu/goforth/forth"
 )
 
+// Some Forth code to load, either from a file or from the command line.
+type source struct {
+	name string
+	code string
+	isFile bool
+}
+
+// The -e flag can be given more than once, and gets run in order with the files.
+type sourceList []source
+
+func (l *sourceList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *sourceList) Set(code string) error {
+	*l = append(*l, source{"-e", code, false})
+	return nil
+}
+
+// Strings don't know their names like files do, but they're nicer in error messages if they have one.
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func (r namedReader) Name() string {
+	return r.name
+}
+
 func main() {
-	vm := NewVirtualMachine()
-	compiler := NewCompiler(vm)
+	os.Exit(runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Does what the command line says, and returns the exit status.
+func runCommand(args []string, stdin *os.File, stdout, stderr io.Writer) int {
+	var sources sourceList
+	flags := flag.NewFlagSet("goforth", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Var(&sources, "e", "evaluate some Forth `code`")
+	interactive := flags.Bool("i", false, "start an interactive session after loading everything else")
+	noBuiltins := flags.Bool("no-builtins", false, "don't load the builtin words")
+	caseSensitive := flags.Bool("case-sensitive", false, "treat words which are spelled with different cases as different words")
+	noTailCalls := flags.Bool("no-tail-calls", false, "compile calls at the end of a word as calls instead of jumps")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: goforth [flags] [file.fs ...]")
+		flags.PrintDefaults()
+	}
+
+	// Flags and files can be mixed together, so keep parsing until we run out of both.
+	for {
+		if err := flags.Parse(args); err != nil {
+			return 2
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		sources = append(sources, source{args[0], "", true})
+		args = args[1:]
+	}
+
+	options := []forth.Option{forth.WithOutput(stdout), forth.WithInput(stdin)}
+	if *caseSensitive {
+		options = append(options, forth.CaseSensitive())
+	}
+	if *noBuiltins {
+		options = append(options, forth.WithoutBuiltins())
+	}
+	if *noTailCalls {
+		options = append(options, forth.WithoutTailCalls())
+	}
+	f := forth.New(options...)
+
+	var err error
+	for _, s := range sources {
+		if err = loadSource(f, s); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		if *interactive || (len(sources) == 0 && forth.IsInteractive(stdin)) {
+			err = f.RunREPL(stdin, stdout)
+		} else if len(sources) == 0 {
+			err = f.Load(stdin)
+		}
+	}
+
+	var bye *forth.Bye
+	if errors.As(err, &bye) {
+		return bye.Code
+	} else if err != nil {
+		fmt.Fprintf(stderr, "goforth: %s\n", strings.ReplaceAll(err.Error(), "\n", "\ngoforth: "))
+		return 1
+	}
+	return 0
+}
+
+func loadSource(f *forth.Forth, s source) error {
+	if !s.isFile {
+		return f.Load(namedReader{strings.NewReader(s.code), s.name})
+	}
 
-	compiler.LoadBuiltins()
-	compiler.LoadCode(bufio.NewReader(os.Stdin))
-	vm.Run()
+	file, err := os.Open(s.name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return f.Load(file)
 }
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, dir string, name string, code string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func assertExitStatus(t *testing.T, expected int, expectedError string, args ...string) {
+	var stdout, stderr bytes.Buffer
+	status := runCommand(args, nil, &stdout, &stderr)
+	if status != expected {
+		t.Errorf("Expected %v to exit with status %d, but got %d: %s", args, expected, status, stderr.String())
+	}
+	if stderr.String() != expectedError {
+		t.Errorf("Expected %v to print %q, but got %q", args, expectedError, stderr.String())
+	}
+}
+
+func Example_command_line() {
+	dir, _ := ioutil.TempDir("", "goforth")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "one.fs"), []byte(": double 2 * ;"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "two.fs"), []byte("5 double ."), 0644)
+
+	runCommand([]string{"-e", `"start" . cr`, filepath.Join(dir, "one.fs"), filepath.Join(dir, "two.fs"), "-e", "cr 3 double ."}, nil, os.Stdout, os.Stderr)
+	// Output:
+	// start
+	// 10
+	// 6
+}
+
+func TestExitStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goforth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bad := writeTempFile(t, dir, "bad.fs", ": foo\n  1 then ;")
+
+	assertExitStatus(t, 0, "", "-e", "1 2 +")
+	assertExitStatus(t, 0, "", "-e", "bye", "-e", "1 0 /")
+	assertExitStatus(t, 7, "", "-e", "7 (bye)")
+	assertExitStatus(t, 1, "goforth: -e:1:5: in 'top-level code': -10 division by zero\n", "-e", "1 0 /")
+	assertExitStatus(t, 1, "goforth: -e:1:3: in 'top-level code': -1 aborted\n", "-e", "1 abort")
+	assertExitStatus(t, 1, "goforth: " + bad + ":2:5: can't compile 'then': no matching 'if'\n", bad)
+	assertExitStatus(t, 1, "goforth: -e:1:1: can't compile 'true': undefined word (did you mean 'type'?)\n", "--no-builtins", "-e", "true")
+	assertExitStatus(t, 0, "", "-e", "1 DUP")
+	assertExitStatus(t, 1, "goforth: -e:1:3: can't compile 'DUP': undefined word (did you mean 'dup'?)\n", "-case-sensitive", "-e", "1 DUP")
+	assertExitStatus(t, 0, "", "-e", ": f ?dup if 1- recurse then ; 100000 f")
+	assertExitStatus(t, 1, "goforth: -e:1:16: in 'f': -5 return stack overflow\n", "-no-tail-calls", "-e", ": f ?dup if 1- recurse then ; 100000 f")
+	assertExitStatus(t, 1, "goforth: open nowhere.fs: no such file or directory\n", "nowhere.fs")
+}
+
+func TestInteractiveFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goforth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdin, err := os.Open(writeTempFile(t, dir, "input", "foo\n3 (bye)\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+
+	var stdout, stderr bytes.Buffer
+	status := runCommand([]string{"-i", "-e", ": foo 1 ;"}, stdin, &stdout, &stderr)
+	if status != 3 || stdout.String() != " ok 1\n" {
+		t.Errorf("Expected the REPL to see foo and exit with status 3, but got %d and %q", status, stdout.String())
+	}
+}